@@ -3,6 +3,9 @@ package app
 import (
 	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	negronilogrus "github.com/meatballhat/negroni-logrus"
@@ -13,6 +16,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
 	"github.com/wyattjoh/ims/cmd/ims/handlers"
+	"github.com/wyattjoh/ims/internal/image"
+	"github.com/wyattjoh/ims/internal/image/transform"
+	"github.com/wyattjoh/ims/internal/platform/cache"
+	"github.com/wyattjoh/ims/internal/platform/clienthints"
+	"github.com/wyattjoh/ims/internal/platform/limiter"
 	"github.com/wyattjoh/ims/internal/platform/providers"
 	"github.com/wyattjoh/ims/internal/platform/signing"
 )
@@ -57,6 +65,112 @@ type ServerOpts struct {
 	// IncludePath when true will add the path component to the signing value
 	// when request signing has been enabled.
 	IncludePath bool
+
+	// DisableAutoOrient disables orienting images based on their EXIF
+	// orientation tag.
+	DisableAutoOrient bool
+
+	// ResultCache is the reference to the cache used to store processed
+	// images.
+	ResultCache string
+
+	// ResultCacheSize is the maximum number of bytes used by the result cache.
+	ResultCacheSize int64
+
+	// ResultCacheTTL is the time that processed images will be stored in the
+	// result cache.
+	ResultCacheTTL time.Duration
+
+	// ReadTimeout is the maximum duration for reading the entire request.
+	ReadTimeout time.Duration
+
+	// ReadHeaderTimeout is the maximum duration for reading the request
+	// headers.
+	ReadHeaderTimeout time.Duration
+
+	// WriteTimeout is the maximum duration before timing out writes of the
+	// response, which includes the time spent processing the image.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time to wait for the next request
+	// when keep-alives are enabled.
+	IdleTimeout time.Duration
+
+	// ShutdownTimeout is the maximum amount of time to wait for the in-flight
+	// requests to complete when shutting down, where zero will wait until they
+	// have all completed.
+	ShutdownTimeout time.Duration
+
+	// ReadinessCanary is the filename that is loaded from each provider to
+	// determine if the server is ready, when empty the providers are not
+	// probed.
+	ReadinessCanary string
+
+	// ReadinessTimeout is the maximum amount of time to wait for the providers
+	// to load the readiness canary.
+	ReadinessTimeout time.Duration
+
+	// MaxSourceWidth is the maximum width of the source images in pixels.
+	MaxSourceWidth int
+
+	// MaxSourceHeight is the maximum height of the source images in pixels.
+	MaxSourceHeight int
+
+	// MaxSourceMegapixels is the maximum number of pixels in the source images
+	// in millions.
+	MaxSourceMegapixels float64
+
+	// MaxSourceBytes is the maximum size of the source images in bytes.
+	MaxSourceBytes int64
+
+	// MaxConcurrentTransforms is the maximum number of images that are
+	// processed concurrently, where zero will not limit them.
+	MaxConcurrentTransforms int
+
+	// MaxQueuedTransforms is the maximum number of images that will wait to be
+	// processed when the MaxConcurrentTransforms are being processed.
+	MaxQueuedTransforms int
+
+	// OriginCacheControl enables using the caching headers of the source
+	// images instead of the CacheTimeout.
+	OriginCacheControl bool
+
+	// MinCacheTimeout is the minimum max age used when it's provided by the
+	// source image.
+	MinCacheTimeout time.Duration
+
+	// MaxCacheTimeout is the maximum max age used when it's provided by the
+	// source image.
+	MaxCacheTimeout time.Duration
+
+	// StaleWhileRevalidate is the time that stale images may be served while
+	// they are revalidated.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the time that stale images may be served when an error
+	// occurs.
+	StaleIfError time.Duration
+
+	// StrictParams rejects requests with query parameters that are not used by
+	// ims.
+	StrictParams bool
+
+	// FocalPointSidecar is the suffix of the sidecar file that is loaded with
+	// the images to provide their focal point.
+	FocalPointSidecar string
+
+	// ClientHints enables using the client hints of the requests as the
+	// parameters when they are not provided.
+	ClientHints bool
+
+	// OverlayBackend is the origin that the overlay images are loaded from
+	// instead of the backend of the host, where empty will use the backend of
+	// the host.
+	OverlayBackend string
+
+	// FontDir is the directory that fonts are loaded from for the text, in
+	// addition to the fonts shipped in the binary.
+	FontDir string
 }
 
 // Serve creates and starts a new server to provide image resizing services.
@@ -67,7 +181,13 @@ func Serve(opts *ServerOpts) error {
 
 	mux := http.NewServeMux()
 
-	if opts.CacheTimeout != 0 {
+	if opts.OriginCacheControl {
+		logrus.WithFields(logrus.Fields{
+			"timeout":    opts.CacheTimeout.String(),
+			"minTimeout": opts.MinCacheTimeout.String(),
+			"maxTimeout": opts.MaxCacheTimeout.String(),
+		}).Debug("origin cache headers enabled")
+	} else if opts.CacheTimeout != 0 {
 		logrus.WithField("timeout", opts.CacheTimeout.String()).Debug("cache headers enabled")
 	} else {
 		logrus.Debug("cache headers disabled")
@@ -84,8 +204,108 @@ func Serve(opts *ServerOpts) error {
 		return errors.Wrap(err, "cannot create providers")
 	}
 
-	// Wrap the handler with the image handler and the providers.
-	handler := providers.Middleware(p, handlers.Image(opts.CacheTimeout))
+	if opts.DisableAutoOrient {
+		logrus.Debug("auto orientation disabled")
+	}
+
+	if opts.StrictParams {
+		logrus.Debug("strict parameters enabled")
+	}
+
+	if opts.FocalPointSidecar != "" {
+		logrus.WithField("suffix", opts.FocalPointSidecar).Debug("focal point sidecars enabled")
+	}
+
+	// Get the provider for the overlay images when they are loaded from their
+	// own backend.
+	overlays := image.NewOverlays(nil)
+	if opts.OverlayBackend != "" {
+		if overlays.Provider, err = providers.GetOriginProvider(ctx, opts.OverlayBackend, opts.OriginCache); err != nil {
+			return errors.Wrap(err, "cannot create the overlay provider")
+		}
+
+		logrus.WithField("origin", opts.OverlayBackend).Debug("overlays served from the overlay backend")
+	}
+
+	// Load the fonts for the text before the requests are served.
+	if opts.FontDir != "" {
+		fonts, err := transform.LoadFonts(opts.FontDir)
+		if err != nil {
+			return errors.Wrap(err, "cannot load the fonts")
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"dir":   opts.FontDir,
+			"fonts": fonts,
+		}).Debug("fonts loaded")
+	}
+
+	// Mount the health and readiness handlers on the mux.
+	MountEndpoint(mux, "/healthz", handlers.Health())
+	MountEndpoint(mux, "/readyz", handlers.Ready(p, opts.ReadinessCanary, opts.ReadinessTimeout))
+
+	if opts.ReadinessCanary != "" {
+		logrus.WithField("canary", opts.ReadinessCanary).Debug("readiness probes enabled")
+	} else {
+		logrus.Debug("readiness probes disabled, --readiness-canary not provided")
+	}
+
+	if opts.MaxConcurrentTransforms > 0 {
+		logrus.WithFields(logrus.Fields{
+			"concurrency": opts.MaxConcurrentTransforms,
+			"queue":       opts.MaxQueuedTransforms,
+		}).Debug("transform limiter enabled")
+	} else {
+		logrus.Debug("transform limiter disabled")
+	}
+
+	// Create the image handler.
+	handler := handlers.Image(&image.ProcessOpts{
+		CacheTimeout:      opts.CacheTimeout,
+		DisableAutoOrient: opts.DisableAutoOrient,
+		Limits: image.Limits{
+			MaxWidth:      opts.MaxSourceWidth,
+			MaxHeight:     opts.MaxSourceHeight,
+			MaxMegapixels: opts.MaxSourceMegapixels,
+			MaxBytes:      opts.MaxSourceBytes,
+		},
+		Limiter:              limiter.New(opts.MaxConcurrentTransforms, opts.MaxQueuedTransforms),
+		OriginCacheControl:   opts.OriginCacheControl,
+		MinCacheTimeout:      opts.MinCacheTimeout,
+		MaxCacheTimeout:      opts.MaxCacheTimeout,
+		StaleWhileRevalidate: opts.StaleWhileRevalidate,
+		StaleIfError:         opts.StaleIfError,
+		StrictParams:         opts.StrictParams,
+		FocalPointSidecar:    opts.FocalPointSidecar,
+		ClientHints:          opts.ClientHints,
+		Overlays:             overlays,
+	})
+
+	// Get the result cache.
+	c, err := cache.New(opts.ResultCache, opts.ResultCacheSize)
+	if err != nil {
+		return errors.Wrap(err, "cannot create result cache")
+	}
+
+	// Wrap the handler so that identical requests that are in-flight at the
+	// same time are only processed once.
+	handler = cache.CoalesceMiddleware(handler)
+
+	if c != nil {
+		// Wrap the handler with the result cache when it's enabled.
+		handler = cache.Middleware(c, opts.ResultCacheTTL, handler)
+	}
+
+	if opts.ClientHints {
+		// Wrap the handler so that the client hints are used as the parameters,
+		// which must happen before the requests are cached.
+		handler = clienthints.Middleware(handler)
+
+		logrus.Debug("client hints enabled")
+	}
+
+	// Wrap the handler with the providers.
+	handler = providers.Middleware(p, handler)
 
 	if opts.SigningSecret != "" {
 		// Wrap the handler with the signing middleware when we have a secret
@@ -131,11 +351,55 @@ func Serve(opts *ServerOpts) error {
 	// Attach the mux to the middleware handler.
 	n.UseHandler(mux)
 
-	logrus.WithField("address", opts.Addr).Info("now listening")
+	server := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           n,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+	}
+
+	return ListenAndServe(server, opts.ShutdownTimeout)
+}
+
+// ListenAndServe starts the server and waits for an interrupt or termination
+// signal, at which point it will stop accepting new connections and wait for up
+// to the shutdownTimeout for the in-flight requests to complete.
+func ListenAndServe(server *http.Server, shutdownTimeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
 
-	if err := http.ListenAndServe(opts.Addr, n); err != nil {
+	logrus.WithField("address", server.Addr).Info("now listening")
+
+	select {
+	case err := <-errs:
 		return errors.Wrap(err, "could not listen on the address for http traffic")
+	case sig := <-signals:
+		logrus.WithFields(logrus.Fields{
+			"signal":  sig.String(),
+			"timeout": shutdownTimeout.String(),
+		}).Info("shutting down, waiting for in-flight requests to complete")
+	}
+
+	ctx := context.Background()
+	if shutdownTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shutdownTimeout)
+		defer cancel()
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "could not gracefully shutdown the server")
 	}
 
+	logrus.Info("shutdown complete")
+
 	return nil
 }
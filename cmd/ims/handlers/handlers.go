@@ -5,12 +5,13 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/sirupsen/logrus"
 	"github.com/wyattjoh/ims/internal/image"
 	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/image/transform"
+	"github.com/wyattjoh/ims/internal/platform/limiter"
 	"github.com/wyattjoh/ims/internal/platform/providers"
 )
 
@@ -49,10 +50,47 @@ func getFilename(p provider.Provider, r *http.Request) (string, error) {
 	return r.URL.Path[1:], nil
 }
 
+// ParamsError is the response written when query parameters could not be used.
+type ParamsError struct {
+	Error  string                `json:"error"`
+	Params transform.ParamErrors `json:"params"`
+}
+
+// processError writes the response for an error that occurred while processing
+// the image.
+func processError(w http.ResponseWriter, err error) {
+	var params transform.ParamErrors
+	if errors.As(err, &params) {
+		writeJSON(w, http.StatusBadRequest, &ParamsError{
+			Error:  "invalid parameters",
+			Params: params,
+		})
+	} else if errors.Is(err, image.ErrUnsupportedFormat) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	} else if errors.Is(err, image.ErrSourceTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	} else if errors.Is(err, image.ErrDimensionsTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, limiter.ErrQueueFull) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// clearCacheHeaders removes the validators and caching headers, which only
+// apply to the processed image, when it could not be processed.
+func clearCacheHeaders(w http.ResponseWriter) {
+	for _, key := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires"} {
+		w.Header().Del(key)
+	}
+}
+
 // Image is the handler which loads the filename from the request, loads the
 // file via the provider, and processes the image to re-encode it with caching
 // headers.
-func Image(timeout time.Duration) http.HandlerFunc {
+func Image(opts *image.ProcessOpts) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithCancel(r.Context())
 		defer cancel()
@@ -75,10 +113,20 @@ func Image(timeout time.Duration) http.HandlerFunc {
 			return
 		}
 
+		// Validate the parameters before the image is loaded so that invalid
+		// requests are rejected without loading it.
+		o, err := image.ParseOptions(opts, r)
+		if err != nil {
+			processError(w, err)
+			logrus.WithError(err).Error("could not parse the parameters")
+
+			return
+		}
+
 		// Try to get the image from the provider.
 		span, ctx := opentracing.StartSpanFromContext(r.Context(), "provider.Provide")
 
-		m, err := p.Provide(ctx, filename)
+		m, err := provider.ProvideObject(ctx, p, filename)
 		if err != nil {
 			// We got an error! Find out which one.
 			if errors.Is(err, provider.ErrBadGateway) {
@@ -100,13 +148,75 @@ func Image(timeout time.Duration) http.HandlerFunc {
 
 		span.Finish()
 
+		// Reject the image before it's read when the metadata from the provider
+		// shows that it can't be processed.
+		if err := image.CheckSource(opts, m.ContentType, m.Size); err != nil {
+			processError(w, err)
+			logrus.WithError(err).Error("could not process the image")
+
+			return
+		}
+
+		// Load the focal point of the source image when the request crops it
+		// without providing one.
+		focus := image.SourceFocalPoint(ctx, opts, o, p, filename, m)
+
+		// Load the overlay image when the request provides one.
+		span, ctx = opentracing.StartSpanFromContext(r.Context(), "image.LoadOverlay")
+
+		overlay, overlayVersion, err := image.LoadOverlay(ctx, opts, p, r)
+		if err != nil {
+			span.Finish()
+			processError(w, err)
+			logrus.WithError(err).Error("could not load the overlay")
+
+			return
+		}
+
+		span.Finish()
+
+		// Identify the processed image by the version of the source image, so
+		// that clients can revalidate it without it being processed again. The
+		// focal point and the version of the overlay are included as they can
+		// change without the source image, and the processed image can't be
+		// identified when the version of the overlay is unknown.
+		version := m.Version()
+		if focus != nil && version != "" {
+			version += ";fp=" + focus.String()
+		}
+
+		if overlay != nil && version != "" {
+			if overlayVersion != "" {
+				version += ";overlay=" + overlayVersion
+			} else {
+				version = ""
+			}
+		}
+
+		if etag := image.ETag(version, r); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		if !m.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", m.ModTime.UTC().Format(http.TimeFormat))
+		}
+
+		image.WriteCacheHeaders(opts, w, r, m)
+
+		if image.NotModified(r, w.Header()) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
 		// If an error occurred during the image processing, return with an internal
 		// server error.
-		span, ctx = opentracing.StartSpanFromContext(r.Context(), "image.Process")
+		ctx = image.WithOverlay(image.WithFocalPoint(r.Context(), focus), overlay)
+		span, ctx = opentracing.StartSpanFromContext(ctx, "image.Process")
 		defer span.Finish()
 
-		if err := image.Process(ctx, timeout, m, w, r.WithContext(ctx)); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := image.Process(ctx, opts, m, w, r.WithContext(ctx)); err != nil {
+			clearCacheHeaders(w)
+			processError(w, err)
 			logrus.WithError(err).Error("could not process the image")
 
 			return
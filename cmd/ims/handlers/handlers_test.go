@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	stdimage "image"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/wyattjoh/ims/internal/image"
 	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/platform/limiter"
 	"github.com/wyattjoh/ims/internal/platform/providers"
 )
 
@@ -232,7 +240,7 @@ func TestImage(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Call the handler
-			handler := Image(timeout)
+			handler := Image(&image.ProcessOpts{CacheTimeout: timeout})
 			handler(rr, req)
 
 			// Check status code
@@ -261,7 +269,7 @@ func TestImageWithSuccessfulProvider(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	handler := Image(timeout)
+	handler := Image(&image.ProcessOpts{CacheTimeout: timeout})
 	handler(rr, req)
 
 	// Since we don't have actual image processing implemented,
@@ -299,7 +307,7 @@ func TestImageContextCancellation(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	handler := Image(timeout)
+	handler := Image(&image.ProcessOpts{CacheTimeout: timeout})
 	handler(rr, req)
 
 	// The handler should complete (context cancellation is handled internally)
@@ -330,3 +338,335 @@ func BenchmarkGetFilenameProxy(b *testing.B) {
 		getFilename(prov, req)
 	}
 }
+
+// largePNGHeader is the header of a PNG that declares a 60000x60000 image.
+const largePNGHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\xea\x60\x00\x00\xea\x60\x08\x02\x00\x00\x00\x0f\xb0\xe2\x15"
+
+func TestImageLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   image.Limits
+		expected int
+	}{
+		{"too many bytes", image.Limits{MaxBytes: 10}, http.StatusRequestEntityTooLarge},
+		{"too many pixels", image.Limits{MaxMegapixels: 100}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{
+				response: io.NopCloser(strings.NewReader(largePNGHeader)),
+			}
+
+			req := httptest.NewRequest("GET", "/test.png", nil)
+			req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, provider))
+
+			rr := httptest.NewRecorder()
+
+			Image(&image.ProcessOpts{Limits: tt.limits})(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestImageQueueFull(t *testing.T) {
+	// Fill the limiter so that there is no room to process another image.
+	l := limiter.New(1, 0)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer release()
+
+	provider := &mockProvider{
+		response: io.NopCloser(strings.NewReader(largePNGHeader)),
+	}
+
+	req := httptest.NewRequest("GET", "/test.png", nil)
+	req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, provider))
+
+	rr := httptest.NewRecorder()
+
+	Image(&image.ProcessOpts{Limiter: l})(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the Retry-After header to be set, it was not")
+	}
+}
+
+func TestImageConditional(t *testing.T) {
+	// Write a source image to the filesystem so that it has a modification
+	// time.
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewNRGBA(stdimage.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatalf("Failed to encode png: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "test.png"), buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write png: %v", err)
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "test.png"), modTime, modTime); err != nil {
+		t.Fatalf("Failed to set the modification time: %v", err)
+	}
+
+	p := &provider.Filesystem{Dir: http.Dir(dir)}
+	handler := Image(&image.ProcessOpts{CacheTimeout: time.Minute})
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test.png?width=5", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, p))
+
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		return rr
+	}
+
+	rr := serve(nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected the ETag header to be set, it was not")
+	}
+
+	if lastModified := rr.Header().Get("Last-Modified"); lastModified != modTime.Format(http.TimeFormat) {
+		t.Errorf("Expected the Last-Modified header to be %s, got %s", modTime.Format(http.TimeFormat), lastModified)
+	}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"different etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.headers)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+
+			if rr.Code == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %d bytes", rr.Body.Len())
+			}
+
+			if rr.Header().Get("Cache-Control") == "" {
+				t.Errorf("Expected the Cache-Control header to be set, it was not")
+			}
+		})
+	}
+}
+
+// mockObjectProvider is a provider that also provides metadata.
+type mockObjectProvider struct {
+	mockProvider
+	contentType string
+	size        int64
+}
+
+func (m *mockObjectProvider) ProvideObject(ctx context.Context, filename string) (*provider.Object, error) {
+	rc, err := m.Provide(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider.Object{ReadCloser: rc, ContentType: m.contentType, Size: m.size}, nil
+}
+
+func TestImageSourceMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int64
+		expected    int
+	}{
+		{"not an image", "text/html; charset=utf-8", 0, http.StatusUnsupportedMediaType},
+		{"too large", "image/png", 1 << 20, http.StatusRequestEntityTooLarge},
+		{"generic binary", "application/octet-stream", 0, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &mockObjectProvider{
+				mockProvider: mockProvider{response: io.NopCloser(strings.NewReader(largePNGHeader))},
+				contentType:  tt.contentType,
+				size:         tt.size,
+			}
+
+			req := httptest.NewRequest("GET", "/test.png", nil)
+			req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, p))
+
+			rr := httptest.NewRecorder()
+
+			Image(&image.ProcessOpts{Limits: image.Limits{MaxBytes: 1024, MaxMegapixels: 100}})(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestImageInvalidParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		strict   bool
+		expected []string
+	}{
+		{"invalid", "crop=abc&blur=-3&fit=stretch&quality=500", false, []string{"crop", "fit", "blur", "quality"}},
+		{"unknown", "widht=10", true, []string{"widht"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The provider would respond with a 404, which shows that the
+			// parameters are validated before the image is loaded.
+			p := &mockProvider{error: provider.ErrNotFound}
+
+			req := httptest.NewRequest("GET", "/test.png?"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, p))
+
+			rr := httptest.NewRecorder()
+
+			Image(&image.ProcessOpts{StrictParams: tt.strict})(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %s", contentType)
+			}
+
+			var body ParamsError
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("Expected a JSON body, got %v", err)
+			}
+
+			var params []string
+			for _, e := range body.Params {
+				params = append(params, e.Param)
+			}
+
+			if strings.Join(params, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected errors for %v, got %v", tt.expected, params)
+			}
+		})
+	}
+}
+
+func TestImageOverlay(t *testing.T) {
+	dir := t.TempDir()
+
+	// The source image is black and the overlay is white, so that the overlay
+	// can be found in the processed image.
+	for name, m := range map[string]*stdimage.Gray{
+		"test.png": stdimage.NewGray(stdimage.Rect(0, 0, 20, 20)),
+		"logo.png": {Pix: bytes.Repeat([]byte{255}, 16), Stride: 4, Rect: stdimage.Rect(0, 0, 4, 4)},
+	} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, m); err != nil {
+			t.Fatalf("Failed to encode png: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to write png: %v", err)
+		}
+	}
+
+	p := &provider.Filesystem{Dir: http.Dir(dir)}
+	handler := Image(&image.ProcessOpts{CacheTimeout: time.Minute, Overlays: image.NewOverlays(nil)})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"overlay", "overlay=logo.png&overlay-pos=bottom-right", http.StatusOK},
+		{"missing overlay", "overlay=missing.png", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test.png?"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, p))
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+
+			if tt.status != http.StatusOK {
+				if etag := rr.Header().Get("ETag"); etag != "" {
+					t.Errorf("Expected no ETag header, got %s", etag)
+				}
+
+				return
+			}
+
+			m, err := png.Decode(rr.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode the processed image: %v", err)
+			}
+
+			if r, _, _, _ := m.At(19, 19).RGBA(); r != 0xffff {
+				t.Errorf("Expected the overlay in the bottom right corner")
+			}
+
+			if r, _, _, _ := m.At(0, 0).RGBA(); r != 0 {
+				t.Errorf("Expected the image to be unchanged outside of the overlay")
+			}
+		})
+	}
+
+	// The ETag changes when the overlay changes, even though the source image
+	// has not.
+	etag := func() string {
+		req := httptest.NewRequest("GET", "/test.png?overlay=logo.png", nil)
+		req = req.WithContext(context.WithValue(req.Context(), providers.ContextKey, p))
+
+		rr := httptest.NewRecorder()
+		Image(&image.ProcessOpts{CacheTimeout: time.Minute, Overlays: image.NewOverlays(nil)})(rr, req)
+
+		return rr.Header().Get("ETag")
+	}
+
+	before := etag()
+	if before == "" {
+		t.Fatalf("Expected the ETag header to be set, it was not")
+	}
+
+	modified := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "logo.png"), modified, modified); err != nil {
+		t.Fatalf("Failed to modify the overlay: %v", err)
+	}
+
+	if after := etag(); after == before {
+		t.Errorf("Expected the ETag to change with the overlay, got %s", after)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/platform/providers"
+)
+
+const (
+	// StatusOK is reported when the check has passed.
+	StatusOK = "ok"
+
+	// StatusUnavailable is reported when the check has failed.
+	StatusUnavailable = "unavailable"
+
+	// StatusSkipped is reported when the provider was not probed.
+	StatusSkipped = "skipped"
+)
+
+// HostStatus is the readiness of the provider attached to a host.
+type HostStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadyStatus is the readiness of the server.
+type ReadyStatus struct {
+	Status string                 `json:"status"`
+	Hosts  map[string]*HostStatus `json:"hosts"`
+}
+
+// writeJSON writes the value out as JSON with the status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("could not write the response")
+	}
+}
+
+// Health is the handler which reports that the server is alive.
+func Health() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	}
+}
+
+// probe loads the canary from the provider to verify that it can serve images.
+func probe(ctx context.Context, p provider.Provider, canary string) *HostStatus {
+	// Proxy providers do not have a backend of their own to probe.
+	if _, ok := p.(*provider.Proxy); ok {
+		return &HostStatus{Status: StatusSkipped}
+	}
+
+	m, err := p.Provide(ctx, canary)
+	if err != nil {
+		return &HostStatus{Status: StatusUnavailable, Error: err.Error()}
+	}
+	m.Close()
+
+	return &HostStatus{Status: StatusOK}
+}
+
+// Ready is the handler which reports if the server is ready to serve images.
+// When a canary is provided, it will be loaded from the provider attached to
+// each host within the timeout, and the server is only ready when all of them
+// succeed.
+func Ready(p *providers.Providers, canary string, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := &ReadyStatus{
+			Status: StatusOK,
+			Hosts:  make(map[string]*HostStatus),
+		}
+
+		if canary == "" {
+			for _, host := range p.Hosts() {
+				status.Hosts[host] = &HostStatus{Status: StatusSkipped}
+			}
+
+			writeJSON(w, http.StatusOK, status)
+			return
+		}
+
+		ctx := r.Context()
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, host := range p.Hosts() {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+
+				hostStatus := probe(ctx, p.Get(host), canary)
+
+				mu.Lock()
+				status.Hosts[host] = hostStatus
+				mu.Unlock()
+			}(host)
+		}
+		wg.Wait()
+
+		code := http.StatusOK
+		for host, hostStatus := range status.Hosts {
+			if hostStatus.Status == StatusUnavailable {
+				logrus.WithField("host", host).WithField("error", hostStatus.Error).Warn("provider is not ready")
+
+				status.Status = StatusUnavailable
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		writeJSON(w, code, status)
+	}
+}
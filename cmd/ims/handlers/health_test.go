@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/platform/providers"
+)
+
+func TestHealth(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Health()(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected content type application/json, got %s", contentType)
+	}
+}
+
+func TestReady(t *testing.T) {
+	ok := func() provider.Provider {
+		return &mockProvider{response: io.NopCloser(strings.NewReader("image"))}
+	}
+
+	tests := []struct {
+		name      string
+		providers map[string]provider.Provider
+		canary    string
+		code      int
+		hosts     map[string]string
+	}{
+		{
+			name:      "without a canary",
+			providers: map[string]provider.Provider{"1.com": &mockProvider{error: provider.ErrNotFound}},
+			code:      http.StatusOK,
+			hosts:     map[string]string{"1.com": StatusSkipped},
+		},
+		{
+			name:      "with a canary",
+			providers: map[string]provider.Provider{"1.com": ok(), "2.com": ok()},
+			canary:    "canary.png",
+			code:      http.StatusOK,
+			hosts:     map[string]string{"1.com": StatusOK, "2.com": StatusOK},
+		},
+		{
+			name:      "with a failing provider",
+			providers: map[string]provider.Provider{"1.com": ok(), "2.com": &mockProvider{error: provider.ErrBadGateway}},
+			canary:    "canary.png",
+			code:      http.StatusServiceUnavailable,
+			hosts:     map[string]string{"1.com": StatusOK, "2.com": StatusUnavailable},
+		},
+		{
+			name:      "with a proxy provider",
+			providers: map[string]provider.Provider{"1.com": provider.NewProxy(nil)},
+			canary:    "canary.png",
+			code:      http.StatusOK,
+			hosts:     map[string]string{"1.com": StatusSkipped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			Ready(providers.NewProviders(tt.providers), tt.canary, time.Second)(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+			if rr.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, rr.Code)
+			}
+
+			var status ReadyStatus
+			if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+				t.Fatalf("Expected no error decoding the status, got %v", err)
+			}
+
+			for host, expected := range tt.hosts {
+				hostStatus, ok := status.Hosts[host]
+				if !ok {
+					t.Errorf("Expected host %s to be reported, it was not", host)
+					continue
+				}
+
+				if hostStatus.Status != expected {
+					t.Errorf("Expected host %s to have status %s, got %s", host, expected, hostStatus.Status)
+				}
+			}
+		})
+	}
+}
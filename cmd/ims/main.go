@@ -18,20 +18,60 @@ import (
 const (
 	// These flags are used as constants to refer to the different supported flags
 	// by the application.
-	flagJSON                   = "json"
-	flagListenAddr             = "listen-addr"
-	flagDebug                  = "debug"
-	flagBackend                = "backend"
-	flagOriginCache            = "origin-cache"
-	flagDisableMetrics         = "disable-metrics"
-	flagTimeout                = "timeout"
-	flagCORSDomain             = "cors-domain"
-	flagSigningSecret          = "signing-secret"
-	flagIncludePathWhenSigning = "signing-with-path"
-	flagTracingURI             = "tracing-uri"
-
-	defaultListenAddr = "127.0.0.1:8080"
-	defaultTimeout    = 15 * time.Minute
+	flagJSON                    = "json"
+	flagListenAddr              = "listen-addr"
+	flagDebug                   = "debug"
+	flagBackend                 = "backend"
+	flagOriginCache             = "origin-cache"
+	flagDisableMetrics          = "disable-metrics"
+	flagTimeout                 = "timeout"
+	flagCORSDomain              = "cors-domain"
+	flagSigningSecret           = "signing-secret"
+	flagIncludePathWhenSigning  = "signing-with-path"
+	flagTracingURI              = "tracing-uri"
+	flagDisableAutoOrient       = "disable-auto-orient"
+	flagResultCache             = "result-cache"
+	flagResultCacheSize         = "result-cache-size"
+	flagResultCacheTTL          = "result-cache-ttl"
+	flagReadTimeout             = "read-timeout"
+	flagReadHeaderTimeout       = "read-header-timeout"
+	flagWriteTimeout            = "write-timeout"
+	flagIdleTimeout             = "idle-timeout"
+	flagShutdownTimeout         = "shutdown-timeout"
+	flagReadinessCanary         = "readiness-canary"
+	flagReadinessTimeout        = "readiness-timeout"
+	flagMaxSourceWidth          = "max-source-width"
+	flagMaxSourceHeight         = "max-source-height"
+	flagMaxSourceMegapixels     = "max-source-megapixels"
+	flagMaxSourceBytes          = "max-source-bytes"
+	flagMaxConcurrentTransforms = "max-concurrent-transforms"
+	flagMaxQueuedTransforms     = "max-queued-transforms"
+	flagOriginCacheControl      = "origin-cache-control"
+	flagMinTimeout              = "min-timeout"
+	flagMaxTimeout              = "max-timeout"
+	flagStaleWhileRevalidate    = "stale-while-revalidate"
+	flagStaleIfError            = "stale-if-error"
+	flagStrictParams            = "strict-params"
+	flagFocalPointSidecar       = "focal-point-sidecar"
+	flagClientHints             = "client-hints"
+	flagOverlayBackend          = "overlay-backend"
+	flagFontDir                 = "font-dir"
+
+	defaultListenAddr          = "127.0.0.1:8080"
+	defaultTimeout             = 15 * time.Minute
+	defaultResultCacheSize     = 256 << 20
+	defaultResultCacheTTL      = time.Hour
+	defaultReadTimeout         = 30 * time.Second
+	defaultReadHeaderTimeout   = 10 * time.Second
+	defaultWriteTimeout        = time.Minute
+	defaultIdleTimeout         = 2 * time.Minute
+	defaultShutdownTimeout     = 30 * time.Second
+	defaultReadinessTimeout    = 5 * time.Second
+	defaultMaxSourceWidth      = 16384
+	defaultMaxSourceHeight     = 16384
+	defaultMaxSourceMegapixels = 100
+	defaultMaxSourceBytes      = 64 << 20
+	defaultMaxQueuedTransforms = 100
 )
 
 var (
@@ -51,6 +91,31 @@ func main() {
 			Value: defaultListenAddr,
 			Usage: "the address to listen for new connections on",
 		},
+		&cli.DurationFlag{
+			Name:  flagReadTimeout,
+			Value: defaultReadTimeout,
+			Usage: "the maximum time to read the entire request, set to 0 to disable",
+		},
+		&cli.DurationFlag{
+			Name:  flagReadHeaderTimeout,
+			Value: defaultReadHeaderTimeout,
+			Usage: "the maximum time to read the request headers, set to 0 to use the read timeout",
+		},
+		&cli.DurationFlag{
+			Name:  flagWriteTimeout,
+			Value: defaultWriteTimeout,
+			Usage: "the maximum time to process the image and write the response, set to 0 to disable",
+		},
+		&cli.DurationFlag{
+			Name:  flagIdleTimeout,
+			Value: defaultIdleTimeout,
+			Usage: "the maximum time to wait for the next request on a keep-alive connection, set to 0 to use the read timeout",
+		},
+		&cli.DurationFlag{
+			Name:  flagShutdownTimeout,
+			Value: defaultShutdownTimeout,
+			Usage: "the maximum time to wait for in-flight requests to complete when shutting down, set to 0 to wait until they complete",
+		},
 		&cli.StringSliceFlag{
 			Name:  flagBackend,
 			Usage: "comma separated <host>,<origin> where <origin> is a pathname or a url (with scheme) to load images from or just <origin> and the host will be the listen address",
@@ -59,6 +124,58 @@ func main() {
 			Name:  flagOriginCache,
 			Usage: "cache the origin resources based on their cache headers (:memory: for memory based cache, directory name for file based, not specified for disabled)",
 		},
+		&cli.StringFlag{
+			Name:  flagResultCache,
+			Usage: "cache the processed images (:memory: for memory based cache, directory name for file based, not specified for disabled)",
+		},
+		&cli.Int64Flag{
+			Name:  flagResultCacheSize,
+			Value: defaultResultCacheSize,
+			Usage: "the maximum number of bytes used by the result cache",
+		},
+		&cli.DurationFlag{
+			Name:  flagResultCacheTTL,
+			Value: defaultResultCacheTTL,
+			Usage: "the time that processed images are kept in the result cache, set to 0 to keep them until evicted",
+		},
+		&cli.StringFlag{
+			Name:  flagReadinessCanary,
+			Usage: "when provided, the filename that is loaded from each backend to determine if the server is ready on /readyz",
+		},
+		&cli.DurationFlag{
+			Name:  flagReadinessTimeout,
+			Value: defaultReadinessTimeout,
+			Usage: "the maximum time to wait for the backends to load the readiness canary",
+		},
+		&cli.IntFlag{
+			Name:  flagMaxSourceWidth,
+			Value: defaultMaxSourceWidth,
+			Usage: "the maximum width of the source images in pixels, larger images are rejected with a 422, set to 0 to disable",
+		},
+		&cli.IntFlag{
+			Name:  flagMaxSourceHeight,
+			Value: defaultMaxSourceHeight,
+			Usage: "the maximum height of the source images in pixels, larger images are rejected with a 422, set to 0 to disable",
+		},
+		&cli.Float64Flag{
+			Name:  flagMaxSourceMegapixels,
+			Value: defaultMaxSourceMegapixels,
+			Usage: "the maximum number of megapixels in the source images, larger images are rejected with a 422, set to 0 to disable",
+		},
+		&cli.Int64Flag{
+			Name:  flagMaxSourceBytes,
+			Value: defaultMaxSourceBytes,
+			Usage: "the maximum size of the source images in bytes, larger images are rejected with a 413, set to 0 to disable",
+		},
+		&cli.IntFlag{
+			Name:  flagMaxConcurrentTransforms,
+			Usage: "the maximum number of images that are processed concurrently, set to 0 to disable",
+		},
+		&cli.IntFlag{
+			Name:  flagMaxQueuedTransforms,
+			Value: defaultMaxQueuedTransforms,
+			Usage: "the maximum number of images that wait to be processed when the concurrency limit is reached, more are rejected with a 503",
+		},
 		&cli.StringFlag{
 			Name:  flagSigningSecret,
 			Usage: "when provided, will be used to verify signed image requests made to the domain",
@@ -71,6 +188,30 @@ func main() {
 			Name:  flagIncludePathWhenSigning,
 			Usage: "when provided, the path will be included in the value to compute the signature",
 		},
+		&cli.BoolFlag{
+			Name:  flagDisableAutoOrient,
+			Usage: "disable orienting images based on their EXIF orientation tag unless requested with orient=1",
+		},
+		&cli.BoolFlag{
+			Name:  flagStrictParams,
+			Usage: "reject requests with query parameters that are not used by ims with a 400, useful to catch typos in development",
+		},
+		&cli.StringFlag{
+			Name:  flagFocalPointSidecar,
+			Usage: "when provided, the suffix of the JSON sidecar file that is loaded with each image from the backend to provide its focal point (such as .json)",
+		},
+		&cli.BoolFlag{
+			Name:  flagClientHints,
+			Usage: "use the Sec-CH-DPR, Sec-CH-Width and Save-Data client hints when the dpr, width and quality are not provided",
+		},
+		&cli.StringFlag{
+			Name:  flagOverlayBackend,
+			Usage: "when provided, the overlay images are loaded from this origin (a directory, or a gs://, s3:// or http(s):// origin) instead of the backend of the host",
+		},
+		&cli.StringFlag{
+			Name:  flagFontDir,
+			Usage: "when provided, the .ttf and .otf fonts in this directory can be selected for the text with txt-font by their lowercased filename without the extension",
+		},
 		&cli.BoolFlag{
 			Name:  flagDisableMetrics,
 			Usage: "disable the prometheus metrics",
@@ -80,6 +221,26 @@ func main() {
 			Value: defaultTimeout,
 			Usage: "used to set the cache control max age headers, set to 0 to disable",
 		},
+		&cli.BoolFlag{
+			Name:  flagOriginCacheControl,
+			Usage: "use the Cache-Control and Expires headers from the backend for the cache control headers, falling back to the --timeout when not provided",
+		},
+		&cli.DurationFlag{
+			Name:  flagMinTimeout,
+			Usage: "the minimum max age when it's provided by the backend with --origin-cache-control, set to 0 to disable",
+		},
+		&cli.DurationFlag{
+			Name:  flagMaxTimeout,
+			Usage: "the maximum max age when it's provided by the backend with --origin-cache-control, set to 0 to disable",
+		},
+		&cli.DurationFlag{
+			Name:  flagStaleWhileRevalidate,
+			Usage: "used to set the stale-while-revalidate cache control directive when not provided by the backend, set to 0 to disable",
+		},
+		&cli.DurationFlag{
+			Name:  flagStaleIfError,
+			Usage: "used to set the stale-if-error cache control directive when not provided by the backend, set to 0 to disable",
+		},
 		&cli.StringSliceFlag{
 			Name:  flagCORSDomain,
 			Usage: "use to enable CORS for the specified domain (note, this is not required to use as an image service)",
@@ -151,15 +312,42 @@ func ServeAction(c *cli.Context) error {
 
 	// Setup the server options.
 	opts := &app.ServerOpts{
-		Addr:           c.String(flagListenAddr),
-		Debug:          c.Bool(flagDebug),
-		DisableMetrics: c.Bool(flagDisableMetrics),
-		Backends:       backends,
-		OriginCache:    c.String(flagOriginCache),
-		CacheTimeout:   c.Duration(flagTimeout),
-		CORSDomains:    c.StringSlice(flagCORSDomain),
-		SigningSecret:  c.String(flagSigningSecret),
-		IncludePath:    c.Bool(flagIncludePathWhenSigning),
+		Addr:                    c.String(flagListenAddr),
+		Debug:                   c.Bool(flagDebug),
+		DisableMetrics:          c.Bool(flagDisableMetrics),
+		Backends:                backends,
+		OriginCache:             c.String(flagOriginCache),
+		CacheTimeout:            c.Duration(flagTimeout),
+		CORSDomains:             c.StringSlice(flagCORSDomain),
+		SigningSecret:           c.String(flagSigningSecret),
+		IncludePath:             c.Bool(flagIncludePathWhenSigning),
+		DisableAutoOrient:       c.Bool(flagDisableAutoOrient),
+		ResultCache:             c.String(flagResultCache),
+		ResultCacheSize:         c.Int64(flagResultCacheSize),
+		ResultCacheTTL:          c.Duration(flagResultCacheTTL),
+		ReadTimeout:             c.Duration(flagReadTimeout),
+		ReadHeaderTimeout:       c.Duration(flagReadHeaderTimeout),
+		WriteTimeout:            c.Duration(flagWriteTimeout),
+		IdleTimeout:             c.Duration(flagIdleTimeout),
+		ShutdownTimeout:         c.Duration(flagShutdownTimeout),
+		ReadinessCanary:         c.String(flagReadinessCanary),
+		ReadinessTimeout:        c.Duration(flagReadinessTimeout),
+		MaxSourceWidth:          c.Int(flagMaxSourceWidth),
+		MaxSourceHeight:         c.Int(flagMaxSourceHeight),
+		MaxSourceMegapixels:     c.Float64(flagMaxSourceMegapixels),
+		MaxSourceBytes:          c.Int64(flagMaxSourceBytes),
+		MaxConcurrentTransforms: c.Int(flagMaxConcurrentTransforms),
+		MaxQueuedTransforms:     c.Int(flagMaxQueuedTransforms),
+		OriginCacheControl:      c.Bool(flagOriginCacheControl),
+		MinCacheTimeout:         c.Duration(flagMinTimeout),
+		MaxCacheTimeout:         c.Duration(flagMaxTimeout),
+		StaleWhileRevalidate:    c.Duration(flagStaleWhileRevalidate),
+		StaleIfError:            c.Duration(flagStaleIfError),
+		StrictParams:            c.Bool(flagStrictParams),
+		FocalPointSidecar:       c.String(flagFocalPointSidecar),
+		ClientHints:             c.Bool(flagClientHints),
+		OverlayBackend:          c.String(flagOverlayBackend),
+		FontDir:                 c.String(flagFontDir),
 	}
 
 	if err := app.Serve(opts); err != nil {
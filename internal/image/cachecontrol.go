@@ -0,0 +1,196 @@
+package image
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/image/encoder"
+	"github.com/wyattjoh/ims/internal/image/provider"
+)
+
+// cachePolicy describes how the processed image may be cached.
+type cachePolicy struct {
+	noStore              bool
+	noCache              bool
+	private              bool
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+// parseCacheControl parses the directives from a Cache-Control header into a
+// map of the lower case directive names to their values.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "" {
+			continue
+		}
+
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+
+	return directives
+}
+
+// parseSeconds parses the value of a directive that is a number of seconds.
+func parseSeconds(value string) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// newCachePolicy creates the cache policy for the processed image, which uses
+// the caching headers of the source image when OriginCacheControl is enabled
+// and falls back to the configured CacheTimeout otherwise.
+func newCachePolicy(opts *ProcessOpts, source *provider.Object, now time.Time) *cachePolicy {
+	policy := &cachePolicy{
+		maxAge:               opts.CacheTimeout,
+		staleWhileRevalidate: opts.StaleWhileRevalidate,
+		staleIfError:         opts.StaleIfError,
+	}
+
+	if !opts.OriginCacheControl || source == nil {
+		return policy
+	}
+
+	directives := parseCacheControl(source.CacheControl)
+
+	if _, ok := directives["no-store"]; ok {
+		return &cachePolicy{noStore: true}
+	}
+
+	_, policy.private = directives["private"]
+	_, policy.noCache = directives["no-cache"]
+
+	// The origin's freshness is preferred from the max-age directive over the
+	// Expires header, like any other cache would.
+	if maxAge, ok := parseSeconds(directives["max-age"]); ok {
+		policy.maxAge = clampMaxAge(opts, maxAge)
+	} else if !source.Expires.IsZero() {
+		maxAge := source.Expires.Sub(now).Truncate(time.Second)
+		if maxAge < 0 {
+			maxAge = 0
+		}
+
+		policy.maxAge = clampMaxAge(opts, maxAge)
+	}
+
+	if staleWhileRevalidate, ok := parseSeconds(directives["stale-while-revalidate"]); ok {
+		policy.staleWhileRevalidate = staleWhileRevalidate
+	}
+
+	if staleIfError, ok := parseSeconds(directives["stale-if-error"]); ok {
+		policy.staleIfError = staleIfError
+	}
+
+	return policy
+}
+
+// clampMaxAge limits the max age from the origin to the configured minimum and
+// maximum, where zero disables the limit.
+func clampMaxAge(opts *ProcessOpts, maxAge time.Duration) time.Duration {
+	if opts.MinCacheTimeout != 0 && maxAge < opts.MinCacheTimeout {
+		maxAge = opts.MinCacheTimeout
+	}
+
+	if opts.MaxCacheTimeout != 0 && maxAge > opts.MaxCacheTimeout {
+		maxAge = opts.MaxCacheTimeout
+	}
+
+	return maxAge
+}
+
+// cacheControl returns the value of the Cache-Control header for the policy.
+func (p *cachePolicy) cacheControl() string {
+	if p.noStore {
+		return "no-store"
+	}
+
+	directives := []string{"public"}
+	if p.private {
+		directives[0] = "private"
+	}
+
+	if p.noCache {
+		directives = append(directives, "no-cache")
+	}
+
+	directives = append(directives, "max-age="+strconv.FormatInt(int64(p.maxAge.Seconds()), 10))
+
+	if p.staleWhileRevalidate != 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.FormatInt(int64(p.staleWhileRevalidate.Seconds()), 10))
+	}
+
+	if p.staleIfError != 0 {
+		directives = append(directives, "stale-if-error="+strconv.FormatInt(int64(p.staleIfError.Seconds()), 10))
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// WriteCacheHeaders writes the headers that control how the processed image is
+// cached, based on the caching headers of the source image when it's
+// provided and the OriginCacheControl option is enabled.
+func WriteCacheHeaders(opts *ProcessOpts, w http.ResponseWriter, r *http.Request, source *provider.Object) {
+	now := time.Now()
+	policy := newCachePolicy(opts, source, now)
+
+	// Write some caching headers if needed, which includes when the origin
+	// provided them even if the image is not to be cached.
+	fromOrigin := opts.OriginCacheControl && source != nil && (source.CacheControl != "" || !source.Expires.IsZero())
+	if policy.noStore || policy.maxAge != 0 || fromOrigin {
+		w.Header().Set("Cache-Control", policy.cacheControl())
+
+		if !policy.noStore {
+			w.Header().Set("Expires", now.Add(policy.maxAge).Format(http.TimeFormat))
+		}
+	}
+
+	// The output format depends on the Accept header when it's negotiated, so
+	// caches must store a variant per header value.
+	if encoder.IsNegotiated(r) {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	// The parameters depend on the client hints when they are enabled.
+	if opts.ClientHints {
+		writeClientHints(w)
+	}
+}
+
+// SharedMaxAge returns how long a shared cache may store the processed image
+// with the header for, based on its Cache-Control header, where zero does not
+// limit it. It returns false when the image must not be stored by a shared
+// cache at all.
+func SharedMaxAge(header http.Header) (time.Duration, bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return 0, false
+		}
+	}
+
+	value, ok := directives["s-maxage"]
+	if !ok {
+		value, ok = directives["max-age"]
+	}
+
+	if !ok {
+		return 0, true
+	}
+
+	maxAge, ok := parseSeconds(value)
+	if !ok || maxAge == 0 {
+		return 0, false
+	}
+
+	return maxAge, true
+}
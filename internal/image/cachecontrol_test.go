@@ -0,0 +1,104 @@
+package image
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/image/provider"
+)
+
+func TestWriteCacheHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ProcessOpts
+		source   *provider.Object
+		expected string
+	}{
+		{
+			name:     "disabled",
+			opts:     ProcessOpts{},
+			expected: "",
+		},
+		{
+			name:     "timeout",
+			opts:     ProcessOpts{CacheTimeout: time.Minute},
+			source:   &provider.Object{CacheControl: "max-age=10"},
+			expected: "public, max-age=60",
+		},
+		{
+			name:     "timeout with stale directives",
+			opts:     ProcessOpts{CacheTimeout: time.Minute, StaleWhileRevalidate: time.Second, StaleIfError: time.Hour},
+			expected: "public, max-age=60, stale-while-revalidate=1, stale-if-error=3600",
+		},
+		{
+			name:     "origin max age",
+			opts:     ProcessOpts{CacheTimeout: time.Minute, OriginCacheControl: true},
+			source:   &provider.Object{CacheControl: "public, max-age=10"},
+			expected: "public, max-age=10",
+		},
+		{
+			name:     "origin without headers",
+			opts:     ProcessOpts{CacheTimeout: time.Minute, OriginCacheControl: true},
+			source:   &provider.Object{},
+			expected: "public, max-age=60",
+		},
+		{
+			name:     "origin private",
+			opts:     ProcessOpts{OriginCacheControl: true},
+			source:   &provider.Object{CacheControl: "private, max-age=10"},
+			expected: "private, max-age=10",
+		},
+		{
+			name:     "origin no cache",
+			opts:     ProcessOpts{OriginCacheControl: true},
+			source:   &provider.Object{CacheControl: "no-cache, max-age=10"},
+			expected: "public, no-cache, max-age=10",
+		},
+		{
+			name:     "origin no store",
+			opts:     ProcessOpts{CacheTimeout: time.Minute, OriginCacheControl: true},
+			source:   &provider.Object{CacheControl: "no-store"},
+			expected: "no-store",
+		},
+		{
+			name:     "origin expires",
+			opts:     ProcessOpts{OriginCacheControl: true},
+			source:   &provider.Object{Expires: time.Now().Add(time.Hour + time.Second)},
+			expected: "public, max-age=3600",
+		},
+		{
+			name:     "origin below the minimum",
+			opts:     ProcessOpts{OriginCacheControl: true, MinCacheTimeout: time.Minute},
+			source:   &provider.Object{CacheControl: "max-age=10"},
+			expected: "public, max-age=60",
+		},
+		{
+			name:     "origin above the maximum",
+			opts:     ProcessOpts{OriginCacheControl: true, MaxCacheTimeout: time.Minute},
+			source:   &provider.Object{CacheControl: "max-age=3600"},
+			expected: "public, max-age=60",
+		},
+		{
+			name:     "origin stale directives",
+			opts:     ProcessOpts{OriginCacheControl: true, StaleWhileRevalidate: time.Second},
+			source:   &provider.Object{CacheControl: "max-age=10, stale-while-revalidate=20, stale-if-error=30"},
+			expected: "public, max-age=10, stale-while-revalidate=20, stale-if-error=30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			WriteCacheHeaders(&tt.opts, rr, httptest.NewRequest("GET", "/image.jpg", nil), tt.source)
+
+			if actual := rr.Header().Get("Cache-Control"); actual != tt.expected {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expected, actual)
+			}
+
+			if expires := rr.Header().Get("Expires"); (expires != "") != (tt.expected != "" && tt.expected != "no-store") {
+				t.Errorf("Expected the Expires header to match the Cache-Control header, got %q", expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package image
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+// saveDataQuality is the quality used for clients that request reduced data
+// usage with the Save-Data hint when the quality is not provided.
+const saveDataQuality = 50
+
+// clientHints are the client hints that are requested from clients and that
+// the processed image varies by.
+var clientHints = []string{"Sec-CH-DPR", "Sec-CH-Width"}
+
+// legacyClientHints are the legacy headers without the `Sec-CH-` prefix that
+// the hints fall back to, and that the processed image also varies by.
+var legacyClientHints = []string{"DPR", "Width"}
+
+// hint returns the value of the client hint, falling back to the legacy header
+// without the `Sec-CH-` prefix.
+func hint(r *http.Request, name string) string {
+	if value := r.Header.Get("Sec-CH-" + name); value != "" {
+		return value
+	}
+
+	return r.Header.Get(name)
+}
+
+// WithClientHints returns a copy of the request where the client hints are
+// added to the query parameters that are not provided, so that they are used
+// like any other parameter, including in the keys of the caches:
+//
+//   - Sec-CH-Width is used as the `width` when neither the `width` or `height`
+//     are provided, which is already in physical pixels so the `dpr` is not
+//     applied to it.
+//   - Sec-CH-DPR is used as the `dpr`.
+//   - Save-Data lowers the `quality`.
+//
+// Hints with invalid values are ignored.
+func WithClientHints(r *http.Request) *http.Request {
+	query := r.URL.Query()
+	changed := false
+
+	widthHint := false
+	if query.Get("width") == "" && query.Get("height") == "" {
+		if width, err := strconv.Atoi(hint(r, "Width")); err == nil && width > 0 {
+			query.Set("width", strconv.Itoa(width))
+			changed, widthHint = true, true
+		}
+	}
+
+	if query.Get("dpr") == "" && !widthHint {
+		if dpr, err := strconv.ParseFloat(hint(r, "DPR"), 64); err == nil && dpr >= 1 && dpr <= transform.MaxDPR {
+			query.Set("dpr", strconv.FormatFloat(dpr, 'f', -1, 64))
+			changed = true
+		}
+	}
+
+	if query.Get("quality") == "" && strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on") {
+		query.Set("quality", strconv.Itoa(saveDataQuality))
+		changed = true
+	}
+
+	if !changed {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+
+	return r
+}
+
+// writeClientHints writes the headers that request the client hints, and that
+// show that the processed image varies by them.
+func writeClientHints(w http.ResponseWriter) {
+	w.Header().Set("Accept-CH", strings.Join(clientHints, ", "))
+	vary := make([]string, 0, len(clientHints)+len(legacyClientHints)+1)
+	vary = append(vary, clientHints...)
+	vary = append(vary, legacyClientHints...)
+	vary = append(vary, "Save-Data")
+
+	w.Header().Add("Vary", strings.Join(vary, ", "))
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithClientHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		headers  map[string]string
+		expected string
+	}{
+		{"no hints", "width=100", nil, "width=100"},
+		{"dpr", "width=100", map[string]string{"Sec-CH-DPR": "2"}, "dpr=2&width=100"},
+		{"legacy dpr", "width=100", map[string]string{"DPR": "1.5"}, "dpr=1.5&width=100"},
+		{"dpr provided", "width=100&dpr=3", map[string]string{"Sec-CH-DPR": "2"}, "width=100&dpr=3"},
+		{"invalid dpr", "width=100", map[string]string{"Sec-CH-DPR": "0.5"}, "width=100"},
+		{"width", "", map[string]string{"Sec-CH-Width": "640", "Sec-CH-DPR": "2"}, "width=640"},
+		{"width provided", "height=100", map[string]string{"Sec-CH-Width": "640"}, "height=100"},
+		{"save data", "", map[string]string{"Save-Data": "on"}, "quality=50"},
+		{"save data with quality", "quality=90", map[string]string{"Save-Data": "on"}, "quality=90"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			if query := WithClientHints(r).URL.RawQuery; query != tt.expected {
+				t.Errorf("Expected the query %q, got %q", tt.expected, query)
+			}
+
+			// The original request is not modified.
+			if r.URL.RawQuery != tt.query {
+				t.Errorf("Expected the original query %q, got %q", tt.query, r.URL.RawQuery)
+			}
+		})
+	}
+}
+
+func TestWriteCacheHeadersClientHints(t *testing.T) {
+	r := httptest.NewRequest("GET", "/image.jpg", nil)
+
+	rr := httptest.NewRecorder()
+	WriteCacheHeaders(&ProcessOpts{}, rr, r, nil)
+
+	if rr.Header().Get("Accept-CH") != "" || rr.Header().Get("Vary") != "" {
+		t.Errorf("Expected no client hint headers, got %v", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	WriteCacheHeaders(&ProcessOpts{ClientHints: true}, rr, r, nil)
+
+	if accept := rr.Header().Get("Accept-CH"); accept != "Sec-CH-DPR, Sec-CH-Width" {
+		t.Errorf("Expected the Accept-CH header to request the hints, got %q", accept)
+	}
+
+	if vary := rr.Header().Get("Vary"); vary != "Sec-CH-DPR, Sec-CH-Width, DPR, Width, Save-Data" {
+		t.Errorf("Expected the Vary header to include the hints, got %q", vary)
+	}
+}
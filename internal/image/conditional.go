@@ -0,0 +1,72 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag for the processed image based on the
+// version of the source image and the canonical transformation parameters. An
+// empty string is returned when the version of the source is unknown.
+func ETag(version string, r *http.Request) string {
+	if version == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(version + "\n" + CanonicalQuery(r)))
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified returns true when the conditional headers on the request match
+// the ETag and Last-Modified validators in the header, meaning that the client
+// already has the current version of the processed image.
+func NotModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// The If-Modified-Since header is ignored when If-None-Match is provided.
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+
+		return matchETag(match, etag)
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		if err != nil {
+			return false
+		}
+
+		modTime, err := http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+
+		return !modTime.Truncate(time.Second).After(sinceTime)
+	}
+
+	return false
+}
+
+// matchETag uses the weak comparison to check if the etag is in the list of
+// entity tags from an If-None-Match header.
+func matchETag(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
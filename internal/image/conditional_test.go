@@ -0,0 +1,75 @@
+package image
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	etag := func(version, target string) string {
+		return ETag(version, httptest.NewRequest("GET", target, nil))
+	}
+
+	if etag("", "/image.jpg?width=10") != "" {
+		t.Errorf("Expected no ETag without a version, got one")
+	}
+
+	base := etag("v1", "/image.jpg?width=10&height=20")
+	if base == "" || base[0] != '"' || base[len(base)-1] != '"' {
+		t.Fatalf("Expected a quoted ETag, got %s", base)
+	}
+
+	if other := etag("v1", "/image.jpg?height=20&width=10&sig=abc"); other != base {
+		t.Errorf("Expected equivalent parameters to have the same ETag, got %s and %s", base, other)
+	}
+
+	if other := etag("v2", "/image.jpg?width=10&height=20"); other == base {
+		t.Errorf("Expected a different version to have a different ETag, it did not")
+	}
+
+	if other := etag("v1", "/image.jpg?width=11&height=20"); other == base {
+		t.Errorf("Expected different parameters to have a different ETag, it did not")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	header := http.Header{
+		"Etag":          []string{`"abc"`},
+		"Last-Modified": []string{modTime.Format(http.TimeFormat)},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		expected bool
+	}{
+		{"unconditional", "GET", nil, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": `"abc"`}, true},
+		{"matching weak etag", "GET", map[string]string{"If-None-Match": `W/"abc"`}, true},
+		{"matching etag in list", "GET", map[string]string{"If-None-Match": `"xyz", "abc"`}, true},
+		{"matching any etag", "GET", map[string]string{"If-None-Match": "*"}, true},
+		{"different etag", "GET", map[string]string{"If-None-Match": `"xyz"`}, false},
+		{"different etag ignores since", "GET", map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": modTime.Format(http.TimeFormat)}, false},
+		{"not modified since", "GET", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, true},
+		{"modified since", "GET", map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"invalid since", "GET", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"not a get", "POST", map[string]string{"If-None-Match": `"abc"`}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/image.jpg", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			if actual := NotModified(r, header); actual != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -7,29 +7,57 @@ import (
 	"github.com/wyattjoh/ims/internal/image/encoder/gif"
 	"github.com/wyattjoh/ims/internal/image/encoder/jpeg"
 	"github.com/wyattjoh/ims/internal/image/encoder/png"
+	"github.com/wyattjoh/ims/internal/image/encoder/webp"
 )
 
-// Get parses the `format` query variable and uses it to see if the user has
-// specified the output format, otherwise, it tries to see if it can
-// encode the image with the source format, otherwise, it just encodes it as
-// "jpeg".
-func Get(format string, r *http.Request) Encoder {
-	switch r.URL.Query().Get("format") {
-	case "jpeg":
-		return jpeg.NewEncoder(r)
-	case "png":
-		return WrapEncoderFunc(png.Encode)
-	case "gif":
-		return WrapEncoderFunc(gif.Encode)
+// formats are the output formats that can be encoded.
+var formats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+	"webp": true,
+}
+
+// output returns the requested format when it can be encoded, otherwise the
+// source format when it can be encoded, otherwise "jpeg".
+func output(requested, source string) string {
+	if formats[requested] {
+		return requested
 	}
 
-	switch format {
-	case "jpeg":
-		return jpeg.NewEncoder(r)
+	if formats[source] {
+		return source
+	}
+
+	return "jpeg"
+}
+
+// Format parses the `format` query variable (negotiating it against the
+// `Accept` header when requested) and uses it to see if the user has specified
+// the output format, otherwise, it tries to see if it can encode the image with
+// the source format, otherwise, it just encodes it as "jpeg". A negotiated
+// WebP is not used in place of a GIF, so that animated GIFs keep their
+// animation.
+func Format(format string, r *http.Request) string {
+	requested := Negotiate(r)
+	if requested == "webp" && IsNegotiated(r) {
+		if fallback := output(r.URL.Query().Get("format"), format); fallback == "gif" {
+			return fallback
+		}
+	}
+
+	return output(requested, format)
+}
+
+// Get returns the Encoder for the output format selected by Format.
+func Get(format string, r *http.Request) Encoder {
+	switch Format(format, r) {
 	case "png":
 		return WrapEncoderFunc(png.Encode)
 	case "gif":
 		return WrapEncoderFunc(gif.Encode)
+	case "webp":
+		return webp.NewEncoder(r)
 	default:
 		return jpeg.NewEncoder(r)
 	}
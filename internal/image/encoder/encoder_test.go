@@ -0,0 +1,38 @@
+package encoder
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		query    string
+		accept   string
+		expected string
+	}{
+		{"source format", "png", "", "image/webp", "png"},
+		{"unknown source format", "bmp", "", "", "jpeg"},
+		{"explicit format", "jpeg", "format=webp", "", "webp"},
+		{"auto with a lossless source", "png", "format=auto", "image/webp", "webp"},
+		{"auto with a lossy source", "jpeg", "format=auto", "image/webp", "webp"},
+		{"auto with an animated source", "gif", "format=auto", "image/webp", "gif"},
+		{"auto without webp support", "png", "format=auto", "image/png", "png"},
+		{"auto webp with a lossless format", "jpeg", "auto=webp&format=png", "image/webp", "webp"},
+		{"auto webp with a lossy format", "png", "auto=webp&format=jpeg", "image/webp", "webp"},
+		{"auto webp with an animated format", "png", "auto=webp&format=gif", "image/webp", "gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image?"+tt.query, nil)
+			r.Header.Set("Accept", tt.accept)
+
+			if format := Format(tt.source, r); format != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
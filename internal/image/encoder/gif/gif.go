@@ -20,3 +20,14 @@ func Encode(i image.Image, w http.ResponseWriter) error {
 
 	return nil
 }
+
+// EncodeAll takes an animation and writes the encoded gif images to it.
+func EncodeAll(g *gif.GIF, w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "image/gif")
+
+	if err := gif.EncodeAll(w, g); err != nil {
+		return errors.Wrap(err, "can't encode the animated gif")
+	}
+
+	return nil
+}
@@ -2,11 +2,14 @@ package jpeg
 
 import (
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"net/http"
 	"strconv"
 
 	"github.com/pkg/errors"
+	"github.com/wyattjoh/ims/internal/image/transform"
 )
 
 // defaultQuality is the quality of the image used when the quality param is
@@ -15,28 +18,58 @@ const defaultQuality = 75
 
 // NewEncoder creates a new Encoder based on the input request, this
 // parses the `q` query variable to check to see if it needs to change the
-// default quality format.
+// default quality format, and the `bg-color` query variable for the color that
+// transparent images are flattened onto.
 func NewEncoder(r *http.Request) Encoder {
 	quality, err := strconv.Atoi(r.URL.Query().Get("quality"))
 	if err != nil || quality == 0 {
 		quality = defaultQuality
 	}
 
+	background, ok := transform.ParseColor(r.URL.Query().Get("bg-color"))
+	if !ok {
+		background = color.White
+	}
+
 	return Encoder{
-		Quality: quality,
+		Quality:    quality,
+		Background: background,
 	}
 }
 
 // Encoder allows the encoding of JPEG's to a http.ResponseWriter.
 type Encoder struct {
 	Quality int
+
+	// Background is the color that transparent images are flattened onto, as
+	// JPEG's can't be transparent. When nil, white is used.
+	Background color.Color
+}
+
+// flatten draws the image onto the background color when it's not opaque.
+// Backgrounds that are not opaque are drawn onto white first.
+func flatten(m image.Image, background color.Color) image.Image {
+	if opaque, ok := m.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return m
+	}
+
+	if background == nil {
+		background = color.White
+	}
+
+	dst := image.NewRGBA(m.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Over)
+	draw.Draw(dst, dst.Bounds(), m, m.Bounds().Min, draw.Over)
+
+	return dst
 }
 
 // Encode writes the encoded image data out to the http.ResponseWriter.
 func (e Encoder) Encode(i image.Image, w http.ResponseWriter) error {
 	w.Header().Set("Content-Type", "image/jpeg")
 
-	if err := jpeg.Encode(w, i, &jpeg.Options{
+	if err := jpeg.Encode(w, flatten(i, e.Background), &jpeg.Options{
 		Quality: e.Quality,
 	}); err != nil {
 		return errors.Wrap(err, "can't encode the jpeg")
@@ -0,0 +1,47 @@
+package jpeg
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncodeFlattensTransparency(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected color.RGBA
+	}{
+		{"", color.RGBA{255, 255, 255, 255}},
+		{"bg-color=f00", color.RGBA{255, 0, 0, 255}},
+		{"bg-color=0,0,255", color.RGBA{0, 0, 255, 255}},
+		{"bg-color=00000000", color.RGBA{255, 255, 255, 255}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/image.png?"+tt.query, nil)
+		rr := httptest.NewRecorder()
+
+		if err := NewEncoder(r).Encode(image.NewNRGBA(image.Rect(0, 0, 8, 8)), rr); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		m, err := jpeg.Decode(rr.Body)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Allow for the loss from the compression.
+		r32, g32, b32, _ := m.At(4, 4).RGBA()
+		for i, c := range []struct{ actual, expected uint8 }{
+			{uint8(r32 >> 8), tt.expected.R},
+			{uint8(g32 >> 8), tt.expected.G},
+			{uint8(b32 >> 8), tt.expected.B},
+		} {
+			if diff := int(c.actual) - int(c.expected); diff > 8 || diff < -8 {
+				t.Errorf("Expected %q to flatten onto %v, got channel %d of %d", tt.query, tt.expected, i, c.actual)
+			}
+		}
+	}
+}
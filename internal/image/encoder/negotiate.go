@@ -0,0 +1,85 @@
+package encoder
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// preferredFormats are the formats, in order of preference, that will be
+// selected when the client explicitly accepts them during negotiation.
+var preferredFormats = []string{"webp"}
+
+// mimeTypes maps the supported formats to their media types.
+var mimeTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// IsNegotiated returns true when the output format for the request is chosen
+// based on the `Accept` header, and therefore responses must be varied on it.
+func IsNegotiated(r *http.Request) bool {
+	values := r.URL.Query()
+
+	return values.Get("format") == "auto" || values.Get("auto") == "webp"
+}
+
+// Negotiate returns the output format for the request. When negotiation was
+// requested via `format=auto` or `auto=webp` and the `Accept` header lists a
+// preferred format, it will be returned, otherwise the `format` query variable
+// is used.
+func Negotiate(r *http.Request) string {
+	values := r.URL.Query()
+	format := values.Get("format")
+
+	switch {
+	case format == "auto":
+		accepted := parseAccept(r.Header.Get("Accept"))
+		for _, preferred := range preferredFormats {
+			if accepted[mimeTypes[preferred]] {
+				return preferred
+			}
+		}
+
+		// Fallback to the source format.
+		return ""
+	case values.Get("auto") == "webp":
+		if parseAccept(r.Header.Get("Accept"))[mimeTypes["webp"]] {
+			return "webp"
+		}
+	}
+
+	return format
+}
+
+// parseAccept parses the `Accept` header and returns the set of media types
+// that were explicitly accepted, wildcards are ignored.
+func parseAccept(header string) map[string]bool {
+	accepted := make(map[string]bool)
+
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" || strings.HasSuffix(mediaType, "*") {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+
+		accepted[mediaType] = quality > 0
+	}
+
+	return accepted
+}
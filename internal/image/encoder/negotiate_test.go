@@ -0,0 +1,80 @@
+package encoder
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		expected   string
+		negotiated bool
+	}{
+		{
+			name:     "explicit format",
+			query:    "format=png",
+			accept:   "image/webp,*/*",
+			expected: "png",
+		},
+		{
+			name:       "auto format with webp support",
+			query:      "format=auto",
+			accept:     "image/avif,image/webp,image/apng,image/*,*/*;q=0.8",
+			expected:   "webp",
+			negotiated: true,
+		},
+		{
+			name:       "auto format without webp support",
+			query:      "format=auto",
+			accept:     "image/png,image/*;q=0.8,*/*;q=0.5",
+			expected:   "",
+			negotiated: true,
+		},
+		{
+			name:       "auto format with webp refused",
+			query:      "format=auto",
+			accept:     "image/webp;q=0,*/*",
+			expected:   "",
+			negotiated: true,
+		},
+		{
+			name:       "auto format with wildcard only",
+			query:      "format=auto",
+			accept:     "*/*",
+			expected:   "",
+			negotiated: true,
+		},
+		{
+			name:       "auto webp overrides format",
+			query:      "auto=webp&format=png",
+			accept:     "image/webp",
+			expected:   "webp",
+			negotiated: true,
+		},
+		{
+			name:       "auto webp falls back to format",
+			query:      "auto=webp&format=png",
+			accept:     "image/png",
+			expected:   "png",
+			negotiated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+			r.Header.Set("Accept", tt.accept)
+
+			if format := Negotiate(r); format != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, format)
+			}
+
+			if negotiated := IsNegotiated(r); negotiated != tt.negotiated {
+				t.Errorf("Expected negotiated to be %v, got %v", tt.negotiated, negotiated)
+			}
+		})
+	}
+}
@@ -0,0 +1,932 @@
+package webp
+
+import (
+	"image"
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// This file contains a pure Go encoder for the WebP lossy bitstream (VP8) as
+// described in RFC 6386. Each macroblock is predicted as a whole with the best
+// of the 16x16 luma and 8x8 chroma predictors, and its residuals are coded
+// with the default token probabilities. libwebp also predicts the 4x4 blocks
+// of each macroblock and adapts the probabilities to the image, so the images
+// are somewhat larger than libwebp's at the same quality.
+
+const (
+	// maxVP8Dimension is the largest width or height VP8 can represent.
+	maxVP8Dimension = 1<<14 - 1
+
+	// numPlanes, numBands, numContexts and numProbs are the dimensions of the
+	// token probabilities.
+	numPlanes   = 4
+	numBands    = 8
+	numContexts = 3
+	numProbs    = 11
+
+	// maxLevel is the largest quantized coefficient that can be coded.
+	maxLevel = 2047
+
+	// maxPartitions is the most partitions that the tokens of the macroblock
+	// rows are split between, and maxPartitionSize the largest size of each.
+	maxPartitions    = 8
+	maxPartitionSize = 1<<24 - 1
+
+	// maxFirstPartitionSize is the largest size of the partition that holds the
+	// headers and the modes of the macroblocks.
+	maxFirstPartitionSize = 1<<19 - 1
+)
+
+// The planes that the token probabilities are chosen by.
+const (
+	planeYAfterY2 = iota
+	planeY2
+	planeUV
+)
+
+// The predictors of the 16x16 luma and 8x8 chroma blocks.
+const (
+	predDC = iota
+	predTM
+	predVE
+	predHE
+)
+
+// predictors are the predictors that are evaluated for each block.
+var predictors = [...]int{predDC, predTM, predVE, predHE}
+
+// bands are the bands of the coefficients in zigzag order, with an extra entry
+// for the position after the last coefficient.
+var bands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+
+// zigzag is the order that the coefficients are coded in.
+var zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+// categoryProbs are the probabilities of the extra bits of the tokens of the
+// categories 3 to 6, and categoryBase the smallest value of each.
+var (
+	categoryProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+	categoryBase = [4]int32{11, 19, 35, 67}
+)
+
+// walshHadamard is the matrix of the Walsh-Hadamard transform of the DC
+// coefficients of the luma blocks.
+var walshHadamard = [4][4]int32{
+	{1, 1, 1, 1},
+	{1, 1, -1, -1},
+	{1, -1, -1, 1},
+	{1, -1, 1, -1},
+}
+
+// The quantizer steps of the DC and AC coefficients for each quantizer index,
+// as specified in section 14.1.
+var (
+	dcSteps = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 10, 11, 12, 13, 14, 15, 16, 17, 17,
+		18, 19, 20, 20, 21, 21, 22, 22, 23, 23, 24, 25, 25, 26, 27, 28,
+		29, 30, 31, 32, 33, 34, 35, 36, 37, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58,
+		59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74,
+		75, 76, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89,
+		91, 93, 95, 96, 98, 100, 101, 102, 104, 106, 108, 110, 112, 114, 116, 118,
+		122, 124, 126, 128, 130, 132, 134, 136, 138, 140, 143, 145, 148, 151, 154, 157,
+	}
+	acSteps = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35,
+		36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+		52, 53, 54, 55, 56, 57, 58, 60, 62, 64, 66, 68, 70, 72, 74, 76,
+		78, 80, 82, 84, 86, 88, 90, 92, 94, 96, 98, 100, 102, 104, 106, 108,
+		110, 112, 114, 116, 119, 122, 125, 128, 131, 134, 137, 140, 143, 146, 149, 152,
+		155, 158, 161, 164, 167, 170, 173, 177, 181, 185, 189, 193, 197, 201, 205, 209,
+		213, 217, 221, 225, 229, 234, 239, 245, 249, 254, 259, 264, 269, 274, 279, 284,
+	}
+)
+
+// =============================================================================
+
+// boolEncoder is the boolean entropy encoder that the partitions are coded
+// with, as described in section 7 of RFC 6386.
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// write writes the bit, where prob is the probability out of 256 that it's
+// false.
+func (e *boolEncoder) write(prob uint8, bit bool) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+
+	for e.rng < 128 {
+		e.rng <<= 1
+
+		if e.bottom&(1<<31) != 0 {
+			// Propagate the carry to the bytes already written.
+			i := len(e.buf) - 1
+			for ; i >= 0 && e.buf[i] == 0xff; i-- {
+				e.buf[i] = 0
+			}
+			e.buf[i]++
+		}
+
+		e.bottom <<= 1
+		e.bitCount--
+
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// writeLiteral writes the lowest n bits of v, most significant bit first.
+func (e *boolEncoder) writeLiteral(v uint32, n int) {
+	for n > 0 {
+		n--
+		e.write(128, v>>n&1 == 1)
+	}
+}
+
+// bytes flushes the pending bits and returns the written data.
+func (e *boolEncoder) bytes() []byte {
+	for i := 0; i < 32; i++ {
+		e.write(128, false)
+	}
+
+	return e.buf
+}
+
+// =============================================================================
+
+// quantizer holds the quantizer steps of the DC and AC coefficients of each
+// plane.
+type quantizer struct {
+	y1, y2, uv [2]int32
+}
+
+// newQuantizer returns the quantizer steps for the quantizer index, as
+// specified in section 9.6.
+func newQuantizer(index int) quantizer {
+	q := quantizer{
+		y1: [2]int32{dcSteps[index], acSteps[index]},
+		y2: [2]int32{dcSteps[index] * 2, acSteps[index] * 155 / 100},
+		uv: [2]int32{dcSteps[min(index, 117)], acSteps[index]},
+	}
+
+	if q.y2[1] < 8 {
+		q.y2[1] = 8
+	}
+
+	return q
+}
+
+// quantizerIndex returns the quantizer index for the quality from 1 to 100,
+// chosen as libwebp does, where lower indexes keep more detail.
+func quantizerIndex(quality int) int {
+	q := float64(quality) / 100
+
+	c := q * 2 / 3
+	if q >= 0.75 {
+		c = 2*q - 1
+	}
+
+	return max(min(int(127*(1-math.Cbrt(c))), 127), 0)
+}
+
+// filterLevel returns the level of the loop filter that smooths the edges of
+// the blocks for the quantizer index, which is stronger as more detail is
+// lost.
+func filterLevel(index int) int {
+	level := int(acSteps[index]) * 3 / 8
+	if level < 2 {
+		return 0
+	}
+
+	return min(level, 63)
+}
+
+// quantize quantizes the coefficient with the step, rounding its magnitude up
+// from the bias out of 256.
+func quantize(c, step, bias int32) int32 {
+	level := min((abs(c)+step*bias>>8)/step, maxLevel)
+	if c < 0 {
+		return -level
+	}
+
+	return level
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+// The biases that the DC and AC coefficients of each plane are rounded up
+// from, which are below one half so that small coefficients become zero.
+var (
+	y1Bias = [2]int32{96, 110}
+	y2Bias = [2]int32{96, 108}
+	uvBias = [2]int32{110, 115}
+)
+
+// =============================================================================
+
+// fdct computes the forward DCT of the 4x4 residual, as libwebp does.
+func fdct(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		d := in[i*4 : i*4+4]
+		a0, a1 := d[0]+d[3], d[1]+d[2]
+		a2, a3 := d[1]-d[2], d[0]-d[3]
+		tmp[i*4+0] = (a0 + a1) * 8
+		tmp[i*4+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[i*4+2] = (a0 - a1) * 8
+		tmp[i*4+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+}
+
+// idct adds the inverse DCT of the coefficients to the 4x4 block of the plane,
+// exactly as the decoder does.
+func idct(in *[16]int32, plane []uint8, offset, stride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2).
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2).
+	)
+
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+
+		row := plane[offset+j*stride : offset+j*stride+4]
+		row[0] = clip8(int32(row[0]) + (a+d)>>3)
+		row[1] = clip8(int32(row[1]) + (b+c)>>3)
+		row[2] = clip8(int32(row[2]) + (b-c)>>3)
+		row[3] = clip8(int32(row[3]) + (a-d)>>3)
+	}
+}
+
+// fwht computes the forward Walsh-Hadamard transform of the DC coefficients of
+// the 16 luma blocks.
+func fwht(in, out *[16]int32) {
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			var sum int32
+			for i := 0; i < 4; i++ {
+				for j := 0; j < 4; j++ {
+					sum += walshHadamard[i][r] * in[i*4+j] * walshHadamard[j][c]
+				}
+			}
+			out[r*4+c] = sum >> 1
+		}
+	}
+}
+
+// iwht computes the inverse Walsh-Hadamard transform of the coefficients,
+// exactly as the decoder does.
+func iwht(in, out *[16]int32) {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0, a1 := in[i]+in[12+i], in[4+i]+in[8+i]
+		a2, a3 := in[4+i]-in[8+i], in[i]-in[12+i]
+		m[i], m[8+i] = a0+a1, a0-a1
+		m[4+i], m[12+i] = a3+a2, a3-a2
+	}
+
+	for i := 0; i < 4; i++ {
+		dc := m[i*4] + 3
+		a0, a1 := dc+m[i*4+3], m[i*4+1]+m[i*4+2]
+		a2, a3 := m[i*4+1]-m[i*4+2], dc-m[i*4+3]
+		out[i*4+0] = int32(int16((a0 + a1) >> 3))
+		out[i*4+1] = int32(int16((a3 + a2) >> 3))
+		out[i*4+2] = int32(int16((a0 - a1) >> 3))
+		out[i*4+3] = int32(int16((a3 - a2) >> 3))
+	}
+}
+
+func clip8(v int32) uint8 {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+
+	return uint8(v)
+}
+
+// =============================================================================
+
+// predictBlock writes the prediction of the size x size block at x, y of the
+// plane with the mode into pred, predicting the edges outside of the image as
+// the decoder does.
+func predictBlock(pred []uint8, plane []uint8, stride, x, y, size, mode int) {
+	var top, left [16]int32
+	for i := 0; i < size; i++ {
+		top[i], left[i] = 127, 129
+		if y > 0 {
+			top[i] = int32(plane[(y-1)*stride+x+i])
+		}
+		if x > 0 {
+			left[i] = int32(plane[(y+i)*stride+x-1])
+		}
+	}
+
+	switch mode {
+	case predDC:
+		var sum, n int32
+		if y > 0 {
+			for _, v := range top[:size] {
+				sum += v
+			}
+			n += int32(size)
+		}
+		if x > 0 {
+			for _, v := range left[:size] {
+				sum += v
+			}
+			n += int32(size)
+		}
+
+		dc := uint8(128)
+		if n > 0 {
+			dc = uint8((sum + n/2) / n)
+		}
+
+		for i := range pred[:size*size] {
+			pred[i] = dc
+		}
+	case predTM:
+		corner := int32(127)
+		if y > 0 && x > 0 {
+			corner = int32(plane[(y-1)*stride+x-1])
+		} else if y > 0 {
+			corner = 129
+		}
+
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				pred[j*size+i] = clip8(left[j] + top[i] - corner)
+			}
+		}
+	case predVE:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				pred[j*size+i] = uint8(top[i])
+			}
+		}
+	case predHE:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				pred[j*size+i] = uint8(left[j])
+			}
+		}
+	}
+}
+
+// =============================================================================
+
+// nzContext records which blocks on the edge of a macroblock have non-zero
+// coefficients, which the probabilities of the next macroblocks depend on.
+type nzContext struct {
+	y, uv [4]uint8
+	y2    uint8
+}
+
+// macroblock holds the modes of a macroblock.
+type macroblock struct {
+	yMode, uvMode int
+	skip          bool
+}
+
+// vp8Encoder holds the state of the encoding of an image.
+type vp8Encoder struct {
+	mbw, mbh int
+
+	// y, u and v are the source planes and ry, ru and rv the planes
+	// reconstructed as the decoder will, which are padded to whole macroblocks.
+	y, u, v    []uint8
+	ry, ru, rv []uint8
+
+	q quantizer
+
+	topNz  []nzContext
+	leftNz nzContext
+
+	mbs        []macroblock
+	partitions []*boolEncoder
+}
+
+// encodeVP8 encodes the pixels as a VP8 bitstream at the quality from 1 to
+// 100.
+func encodeVP8(pix []uint32, width, height, quality int) ([]byte, error) {
+	if width < 1 || height < 1 || width > maxVP8Dimension || height > maxVP8Dimension {
+		return nil, errors.Errorf("invalid webp dimensions %dx%d", width, height)
+	}
+
+	mbw, mbh := (width+15)/16, (height+15)/16
+	index := quantizerIndex(quality)
+
+	e := &vp8Encoder{
+		mbw:   mbw,
+		mbh:   mbh,
+		q:     newQuantizer(index),
+		topNz: make([]nzContext, mbw),
+		mbs:   make([]macroblock, mbw*mbh),
+	}
+
+	e.y, e.u, e.v = yuvPlanes(pix, width, height, mbw, mbh)
+	e.ry = make([]uint8, len(e.y))
+	e.ru = make([]uint8, len(e.u))
+	e.rv = make([]uint8, len(e.v))
+
+	numPartitions := 1
+	for numPartitions < maxPartitions && numPartitions*2 <= mbh {
+		numPartitions *= 2
+	}
+
+	e.partitions = make([]*boolEncoder, numPartitions)
+	for i := range e.partitions {
+		e.partitions[i] = newBoolEncoder()
+	}
+
+	for mby := 0; mby < mbh; mby++ {
+		e.leftNz = nzContext{}
+		for mbx := 0; mbx < mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	first := e.writeHeaders(index, filterLevel(index))
+	if len(first) > maxFirstPartitionSize {
+		return nil, errors.New("the webp is too large")
+	}
+
+	partitions := make([][]byte, numPartitions)
+	size := 10 + len(first) + 3*(numPartitions-1)
+	for i, p := range e.partitions {
+		partitions[i] = p.bytes()
+		if len(partitions[i]) > maxPartitionSize {
+			return nil, errors.New("the webp is too large")
+		}
+		size += len(partitions[i])
+	}
+
+	// Write the frame header of a key frame that is shown.
+	out := make([]byte, 0, size)
+	tag := uint32(len(first))<<5 | 1<<4
+	out = append(out, byte(tag), byte(tag>>8), byte(tag>>16))
+	out = append(out, 0x9d, 0x01, 0x2a)
+	out = append(out, byte(width), byte(width>>8), byte(height), byte(height>>8))
+	out = append(out, first...)
+
+	for _, p := range partitions[:numPartitions-1] {
+		out = append(out, byte(len(p)), byte(len(p)>>8), byte(len(p)>>16))
+	}
+
+	for _, p := range partitions {
+		out = append(out, p...)
+	}
+
+	return out, nil
+}
+
+// yuvPlanes converts the pixels to Y'CbCr with the limited range of BT.601 as
+// libwebp does, with the chroma planes at half the resolution. The planes are
+// padded to whole macroblocks by repeating the pixels on the edges.
+func yuvPlanes(pix []uint32, width, height, mbw, mbh int) (y, u, v []uint8) {
+	yStride, uvStride := mbw*16, mbw*8
+	y = make([]uint8, yStride*mbh*16)
+	u = make([]uint8, uvStride*mbh*8)
+	v = make([]uint8, uvStride*mbh*8)
+
+	at := func(px, py int) (int32, int32, int32) {
+		p := pix[min(py, height-1)*width+min(px, width-1)]
+		return int32(p >> 16 & 0xff), int32(p >> 8 & 0xff), int32(p & 0xff)
+	}
+
+	for py := 0; py < mbh*16; py++ {
+		for px := 0; px < yStride; px++ {
+			r, g, b := at(px, py)
+			y[py*yStride+px] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+		}
+	}
+
+	for py := 0; py < mbh*8; py++ {
+		for px := 0; px < uvStride; px++ {
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := at(2*px+d[0], 2*py+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+
+			u[py*uvStride+px] = clip8((-9719*r - 19081*g + 28800*b + 1<<17 + 128<<18) >> 18)
+			v[py*uvStride+px] = clip8((28800*r - 24116*g - 4684*b + 1<<17 + 128<<18) >> 18)
+		}
+	}
+
+	return y, u, v
+}
+
+// bestMode returns the mode that predicts the size x size blocks at x, y of
+// the source planes with the smallest squared error, predicting them from the
+// reconstructed planes.
+func bestMode(src, recon [][]uint8, stride, x, y, size int) int {
+	var pred [256]uint8
+
+	best, bestErr := predDC, int64(math.MaxInt64)
+	for _, mode := range predictors {
+		var sse int64
+		for p := range src {
+			predictBlock(pred[:], recon[p], stride, x, y, size, mode)
+			for j := 0; j < size; j++ {
+				for i := 0; i < size; i++ {
+					d := int64(src[p][(y+j)*stride+x+i]) - int64(pred[j*size+i])
+					sse += d * d
+				}
+			}
+		}
+
+		if sse < bestErr {
+			best, bestErr = mode, sse
+		}
+	}
+
+	return best
+}
+
+// encodeMacroblock chooses the modes of the macroblock, quantizes its
+// residuals, reconstructs it as the decoder will, and writes its tokens.
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	mb := &e.mbs[mby*e.mbw+mbx]
+	yStride, uvStride := e.mbw*16, e.mbw*8
+	x, y := mbx*16, mby*16
+
+	// Predict the luma and transform the residual of each 4x4 block, moving
+	// their DC coefficients to the Y2 block.
+	mb.yMode = bestMode([][]uint8{e.y}, [][]uint8{e.ry}, yStride, x, y, 16)
+
+	var pred [256]uint8
+	predictBlock(pred[:], e.ry, yStride, x, y, 16, mb.yMode)
+
+	var coeffs [16][16]int32
+	var dcs, y2 [16]int32
+	for b := range coeffs {
+		bx, by := x+b%4*4, y+b/4*4
+
+		var residual [16]int32
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				residual[j*4+i] = int32(e.y[(by+j)*yStride+bx+i]) - int32(pred[(by-y+j)*16+bx-x+i])
+			}
+		}
+
+		fdct(&residual, &coeffs[b])
+		dcs[b] = coeffs[b][0]
+	}
+
+	fwht(&dcs, &y2)
+
+	var y2Levels, y2Dequant [16]int32
+	skip := true
+	for i, c := range y2 {
+		k := min(i, 1)
+		y2Levels[i] = quantize(c, e.q.y2[k], y2Bias[k])
+		y2Dequant[i] = int32(int16(y2Levels[i] * e.q.y2[k]))
+		skip = skip && y2Levels[i] == 0
+	}
+
+	iwht(&y2Dequant, &dcs)
+
+	var yLevels [16][16]int32
+	for b := range coeffs {
+		for i := 1; i < 16; i++ {
+			yLevels[b][i] = quantize(coeffs[b][i], e.q.y1[1], y1Bias[1])
+			skip = skip && yLevels[b][i] == 0
+		}
+	}
+
+	for j := 0; j < 16; j++ {
+		copy(e.ry[(y+j)*yStride+x:], pred[j*16:j*16+16])
+	}
+
+	for b := range yLevels {
+		dequant := [16]int32{dcs[b]}
+		for i := 1; i < 16; i++ {
+			dequant[i] = int32(int16(yLevels[b][i] * e.q.y1[1]))
+		}
+
+		idct(&dequant, e.ry, (y+b/4*4)*yStride+x+b%4*4, yStride)
+	}
+
+	// Predict the chroma and quantize the residual of each 4x4 block.
+	x, y = mbx*8, mby*8
+	mb.uvMode = bestMode([][]uint8{e.u, e.v}, [][]uint8{e.ru, e.rv}, uvStride, x, y, 8)
+
+	var uvLevels [8][16]int32
+	for p, planes := range [2][2][]uint8{{e.u, e.ru}, {e.v, e.rv}} {
+		src, recon := planes[0], planes[1]
+		predictBlock(pred[:], recon, uvStride, x, y, 8, mb.uvMode)
+
+		for j := 0; j < 8; j++ {
+			copy(recon[(y+j)*uvStride+x:], pred[j*8:j*8+8])
+		}
+
+		for b := 0; b < 4; b++ {
+			bx, by := x+b%2*4, y+b/2*4
+
+			var residual, c, dequant [16]int32
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					residual[j*4+i] = int32(src[(by+j)*uvStride+bx+i]) - int32(pred[(by-y+j)*8+bx-x+i])
+				}
+			}
+
+			fdct(&residual, &c)
+
+			levels := &uvLevels[p*4+b]
+			for i := range c {
+				k := min(i, 1)
+				levels[i] = quantize(c[i], e.q.uv[k], uvBias[k])
+				dequant[i] = int32(int16(levels[i] * e.q.uv[k]))
+				skip = skip && levels[i] == 0
+			}
+
+			idct(&dequant, recon, by*uvStride+bx, uvStride)
+		}
+	}
+
+	// Write the tokens, unless every coefficient is zero.
+	mb.skip = skip
+	top := &e.topNz[mbx]
+	if skip {
+		*top, e.leftNz = nzContext{}, nzContext{}
+		return
+	}
+
+	w := e.partitions[mby%len(e.partitions)]
+
+	nz := writeTokens(w, planeY2, top.y2+e.leftNz.y2, &y2Levels, 0)
+	top.y2, e.leftNz.y2 = nz, nz
+
+	for b := range yLevels {
+		i, j := b%4, b/4
+		nz := writeTokens(w, planeYAfterY2, top.y[i]+e.leftNz.y[j], &yLevels[b], 1)
+		top.y[i], e.leftNz.y[j] = nz, nz
+	}
+
+	for b := range uvLevels {
+		// The contexts of the U blocks are the first two, and of the V blocks
+		// the last two.
+		i, j := b/4*2+b%2, b/4*2+b%4/2
+		nz := writeTokens(w, planeUV, top.uv[i]+e.leftNz.uv[j], &uvLevels[b], 0)
+		top.uv[i], e.leftNz.uv[j] = nz, nz
+	}
+}
+
+// writeTokens writes the tokens of the coefficients of a block from the first,
+// returning 1 when any of them is non-zero.
+func writeTokens(w *boolEncoder, plane int, context uint8, levels *[16]int32, first int) uint8 {
+	probs := &defaultTokenProbs[plane]
+
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[zigzag[n]] != 0 {
+			last = n
+		}
+	}
+
+	p := &probs[bands[first]][context]
+	if last < 0 {
+		w.write(p[0], false)
+		return 0
+	}
+
+	w.write(p[0], true)
+
+	for n := first; n < 16; n++ {
+		level := levels[zigzag[n]]
+		v := abs(level)
+
+		if v == 0 {
+			w.write(p[1], false)
+			p = &probs[bands[n+1]][0]
+			continue
+		}
+
+		w.write(p[1], true)
+
+		if v == 1 {
+			w.write(p[2], false)
+			p = &probs[bands[n+1]][1]
+		} else {
+			w.write(p[2], true)
+
+			switch {
+			case v <= 4:
+				w.write(p[3], false)
+				if v == 2 {
+					w.write(p[4], false)
+				} else {
+					w.write(p[4], true)
+					w.write(p[5], v == 4)
+				}
+			case v <= 10:
+				w.write(p[3], true)
+				w.write(p[6], false)
+				if v <= 6 {
+					w.write(p[7], false)
+					w.write(159, v == 6)
+				} else {
+					w.write(p[7], true)
+					w.write(165, (v-7)&2 != 0)
+					w.write(145, (v-7)&1 != 0)
+				}
+			default:
+				w.write(p[3], true)
+				w.write(p[6], true)
+
+				category := 3
+				for category > 0 && v < categoryBase[category] {
+					category--
+				}
+
+				w.write(p[8], category >= 2)
+				w.write(p[9+category/2], category&1 == 1)
+
+				extra := v - categoryBase[category]
+				bitProbs := categoryProbs[category]
+				for i, prob := range bitProbs {
+					w.write(prob, extra>>(len(bitProbs)-1-i)&1 == 1)
+				}
+			}
+
+			p = &probs[bands[n+1]][2]
+		}
+
+		w.write(128, level < 0)
+
+		if n == 15 {
+			break
+		}
+
+		w.write(p[0], n < last)
+		if n == last {
+			break
+		}
+	}
+
+	return 1
+}
+
+// writeHeaders writes the first partition, which holds the headers of the
+// frame and the modes of the macroblocks.
+func (e *vp8Encoder) writeHeaders(index, level int) []byte {
+	w := newBoolEncoder()
+
+	// The color space and the clamping type.
+	w.writeLiteral(0, 2)
+
+	// No segmentation.
+	w.writeLiteral(0, 1)
+
+	// The normal loop filter with the level and no sharpness or adjustments.
+	w.writeLiteral(0, 1)
+	w.writeLiteral(uint32(level), 6)
+	w.writeLiteral(0, 3)
+	w.writeLiteral(0, 1)
+
+	// The number of token partitions.
+	w.writeLiteral(uint32(bits.TrailingZeros(uint(len(e.partitions)))), 2)
+
+	// The quantizer index with no deltas.
+	w.writeLiteral(uint32(index), 7)
+	w.writeLiteral(0, 5)
+
+	// Refresh the entropy probabilities.
+	w.writeLiteral(0, 1)
+
+	// Keep the default token probabilities.
+	for i := range tokenUpdateProbs {
+		for j := range tokenUpdateProbs[i] {
+			for k := range tokenUpdateProbs[i][j] {
+				for _, prob := range tokenUpdateProbs[i][j][k] {
+					w.write(prob, false)
+				}
+			}
+		}
+	}
+
+	// The probability that a macroblock has coefficients.
+	var coded int
+	for _, mb := range e.mbs {
+		if !mb.skip {
+			coded++
+		}
+	}
+
+	skipProb := uint8(max(min(coded*255/len(e.mbs), 254), 1))
+	w.writeLiteral(1, 1)
+	w.writeLiteral(uint32(skipProb), 8)
+
+	for _, mb := range e.mbs {
+		w.write(skipProb, mb.skip)
+
+		// The 16x16 luma mode.
+		w.write(145, true)
+		switch mb.yMode {
+		case predDC:
+			w.write(156, false)
+			w.write(163, false)
+		case predVE:
+			w.write(156, false)
+			w.write(163, true)
+		case predHE:
+			w.write(156, true)
+			w.write(128, false)
+		case predTM:
+			w.write(156, true)
+			w.write(128, true)
+		}
+
+		// The chroma mode.
+		switch mb.uvMode {
+		case predDC:
+			w.write(142, false)
+		case predVE:
+			w.write(142, true)
+			w.write(114, false)
+		case predHE:
+			w.write(142, true)
+			w.write(114, true)
+			w.write(183, false)
+		case predTM:
+			w.write(142, true)
+			w.write(114, true)
+			w.write(183, true)
+		}
+	}
+
+	return w.bytes()
+}
+
+// vp8Pixels returns the pixels in the image as non-premultiplied ARGB values
+// with the alpha values separately when any of the pixels are not opaque.
+func vp8Pixels(m image.Image) ([]uint32, []uint8) {
+	pix, hasAlpha := argbPixels(m)
+	if !hasAlpha {
+		return pix, nil
+	}
+
+	alpha := make([]uint8, len(pix))
+	for i, p := range pix {
+		alpha[i] = uint8(p >> 24)
+	}
+
+	return pix, alpha
+}
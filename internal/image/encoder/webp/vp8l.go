@@ -0,0 +1,797 @@
+package webp
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// This file contains a pure Go encoder for the WebP lossless bitstream (VP8L)
+// as described in RFC 9649. It applies the subtract green and predictor
+// transforms, LZ77 backward references and a single set of prefix codes for
+// the whole image, which is enough to produce reasonably compact files without
+// requiring cgo and libwebp.
+
+const (
+	// maxDimension is the largest width or height VP8L can represent.
+	maxDimension = 1 << 14
+
+	// numLiteralCodes, numLengthCodes and numDistanceCodes are the alphabet
+	// sizes used by the prefix codes.
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+
+	// maxCodeLength is the longest permitted prefix code, and
+	// maxCodeLengthCodeLength is the longest permitted code used to encode the
+	// code lengths themselves.
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+
+	// predictorBits is the log-2 size of the blocks that share a predictor.
+	predictorBits = 5
+
+	// The following control the LZ77 backward reference search.
+	hashBits       = 16
+	windowSize     = 1 << 16
+	minMatchLength = 3
+	maxMatchLength = 4096
+	maxChainLength = 32
+
+	// distanceCodeOffset is added to each distance to skip the two
+	// dimensional distance map reserved for short distances.
+	distanceCodeOffset = 120
+)
+
+// codeLengthCodeOrder is the order that the code length code lengths are
+// written in.
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// predictorModes are the predictor modes that are evaluated for each block.
+var predictorModes = [...]int{1, 2, 7, 11, 12, 13}
+
+// =============================================================================
+
+// bitWriter writes values least significant bit first as required by VP8L.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write writes the lowest n bits of v.
+func (b *bitWriter) write(v uint32, n uint) {
+	b.acc |= uint64(v&(1<<n-1)) << b.nbits
+	b.nbits += n
+
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// bytes flushes any pending bits and returns the written data.
+func (b *bitWriter) bytes() []byte {
+	if b.nbits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+
+	return b.buf
+}
+
+// =============================================================================
+
+// encodeVP8L encodes the image as a VP8L bitstream.
+func encodeVP8L(m image.Image) ([]byte, error) {
+	width, height := m.Bounds().Dx(), m.Bounds().Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return nil, errors.Errorf("invalid webp dimensions %dx%d", width, height)
+	}
+
+	pix, hasAlpha := argbPixels(m)
+	clearTransparent(pix)
+
+	bw := &bitWriter{}
+
+	// Write the header.
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	writeImageStream(bw, pix, width, height)
+
+	return bw.bytes(), nil
+}
+
+// encodeAlpha encodes the alpha values as the VP8L image stream, without the
+// header, of an image where they are the green values.
+func encodeAlpha(alpha []uint8, width, height int) []byte {
+	pix := make([]uint32, len(alpha))
+	for i, a := range alpha {
+		pix[i] = 0xff000000 | uint32(a)<<8
+	}
+
+	bw := &bitWriter{}
+	writeImageStream(bw, pix, width, height)
+
+	return bw.bytes()
+}
+
+// writeImageStream writes the transforms and the data of the pixels.
+func writeImageStream(bw *bitWriter, pix []uint32, width, height int) {
+	// Write the subtract green transform.
+	subtractGreen(pix)
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	// Write the predictor transform followed by the sub-image containing the
+	// predictor mode of each block.
+	modes := applyPredictor(pix, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(predictorBits-2, 3)
+	bw.write(0, 1) // No color cache.
+	writeImageData(bw, modes, false)
+
+	// No further transforms.
+	bw.write(0, 1)
+
+	// Write the main image.
+	bw.write(0, 1) // No color cache.
+	bw.write(0, 1) // No meta prefix codes.
+	writeImageData(bw, pix, true)
+}
+
+// argbPixels returns the pixels in the image as non-premultiplied ARGB values
+// and if any of the pixels were not fully opaque.
+func argbPixels(m image.Image) ([]uint32, bool) {
+	b := m.Bounds()
+	pix := make([]uint32, 0, b.Dx()*b.Dy())
+	opaque := uint32(0xff)
+
+	if nrgba, ok := m.(*image.NRGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := nrgba.Pix[nrgba.PixOffset(b.Min.X, y):nrgba.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				a := uint32(row[i+3])
+				opaque &= a
+				pix = append(pix, a<<24|uint32(row[i])<<16|uint32(row[i+1])<<8|uint32(row[i+2]))
+			}
+		}
+
+		return pix, opaque != 0xff
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			opaque &= uint32(c.A)
+			pix = append(pix, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+
+	return pix, opaque != 0xff
+}
+
+// clearTransparent clears the color of the fully transparent pixels, as it's
+// never visible and compresses better when it's the same.
+func clearTransparent(pix []uint32) {
+	for i, p := range pix {
+		if p>>24 == 0 {
+			pix[i] = 0
+		}
+	}
+}
+
+// subtractGreen subtracts the green channel from the red and blue channels.
+func subtractGreen(pix []uint32) {
+	for i, p := range pix {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// =============================================================================
+
+// channelWise applies fn to each of the four channels of the pixels.
+func channelWise(fn func(a, b, c uint32) uint32, a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= fn(a>>shift&0xff, b>>shift&0xff, c>>shift&0xff) << shift
+	}
+
+	return out
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func clampByte(v int32) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+
+	return uint32(v)
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	return clampByte(int32(a) + int32(b) - int32(c))
+}
+
+func clampAddSubtractHalf(a, b, _ uint32) uint32 {
+	return clampByte(int32(a) + (int32(a)-int32(b))/2)
+}
+
+func absDiff(a, b uint32) int32 {
+	if a > b {
+		return int32(a - b)
+	}
+
+	return int32(b - a)
+}
+
+// predict returns the prediction for a pixel not on the top row or left column
+// using the given mode and neighboring pixels.
+func predict(mode int, l, t, tl uint32) uint32 {
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 7:
+		return average2(l, t)
+	case 11:
+		var pl, pt int32
+		for shift := 0; shift < 32; shift += 8 {
+			pl += absDiff(tl>>shift&0xff, t>>shift&0xff)
+			pt += absDiff(tl>>shift&0xff, l>>shift&0xff)
+		}
+		if pl < pt {
+			return l
+		}
+		return t
+	case 12:
+		return channelWise(clampAddSubtractFull, l, t, tl)
+	case 13:
+		return channelWise(clampAddSubtractHalf, average2(l, t), tl, 0)
+	default:
+		return 0xff000000
+	}
+}
+
+// residual returns the per channel difference between the pixel and its
+// prediction.
+func residual(p, pred uint32) uint32 {
+	alphaAndGreen := 0x00ff00ff + p&0xff00ff00 - pred&0xff00ff00
+	redAndBlue := 0xff00ff00 + p&0x00ff00ff - pred&0x00ff00ff
+
+	return alphaAndGreen&0xff00ff00 | redAndBlue&0x00ff00ff
+}
+
+// residualCost estimates the cost of coding a residual, small positive or
+// negative differences are cheapest.
+func residualCost(r uint32) int32 {
+	var cost int32
+	for shift := 0; shift < 32; shift += 8 {
+		if v := int32(int8(r >> shift)); v < 0 {
+			cost -= v
+		} else {
+			cost += v
+		}
+	}
+
+	return cost
+}
+
+// applyPredictor chooses a predictor mode for each block of the image, replaces
+// the pixels with the prediction residuals and returns the sub-image holding
+// the predictor modes.
+func applyPredictor(pix []uint32, width, height int) []uint32 {
+	const blockSize = 1 << predictorBits
+
+	tilesX := (width + blockSize - 1) >> predictorBits
+	tilesY := (height + blockSize - 1) >> predictorBits
+	modes := make([]uint32, tilesX*tilesY)
+
+	// The predictions are made from the original pixels, so work from a copy.
+	orig := make([]uint32, len(pix))
+	copy(orig, pix)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*blockSize, ty*blockSize
+			x1, y1 := min(x0+blockSize, width), min(y0+blockSize, height)
+
+			// Pick the mode with the cheapest residuals for this block.
+			best, bestCost := predictorModes[0], int32(-1)
+			for _, mode := range predictorModes {
+				var cost int32
+				for y := max(y0, 1); y < y1; y++ {
+					for x := max(x0, 1); x < x1; x++ {
+						i := y*width + x
+						cost += residualCost(residual(orig[i], predict(mode, orig[i-1], orig[i-width], orig[i-width-1])))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = orig[i-1]
+			case x == 0:
+				pred = orig[i-width]
+			default:
+				mode := int(modes[(y>>predictorBits)*tilesX+(x>>predictorBits)] >> 8 & 0xf)
+				pred = predict(mode, orig[i-1], orig[i-width], orig[i-width-1])
+			}
+
+			pix[i] = residual(orig[i], pred)
+		}
+	}
+
+	return modes
+}
+
+// =============================================================================
+
+// token is either a literal pixel or a backward reference.
+type token struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// backwardReferences converts the pixels to a sequence of literals and
+// backward references using a hash chain search.
+func backwardReferences(pix []uint32) []token {
+	n := len(pix)
+	tokens := make([]token, 0, n)
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	hash := func(i int) uint32 {
+		return (pix[i]*0x9e3779b1 ^ pix[i+1]*0x85ebca6b) >> (32 - hashBits)
+	}
+
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+
+		if i+minMatchLength <= n {
+			limit := min(maxMatchLength, n-i)
+			candidate := head[hash(i)]
+			for chain := 0; candidate >= 0 && i-int(candidate) <= windowSize && chain < maxChainLength; chain++ {
+				c := int(candidate)
+
+				length := 0
+				for length < limit && pix[c+length] == pix[i+length] {
+					length++
+				}
+
+				if length > bestLength {
+					bestLength, bestDistance = length, i-c
+					if length == limit {
+						break
+					}
+				}
+
+				candidate = prev[c]
+			}
+		}
+
+		if bestLength >= minMatchLength {
+			tokens = append(tokens, token{length: bestLength, distance: bestDistance})
+			for j := 0; j < bestLength; j++ {
+				insert(i + j)
+			}
+			i += bestLength
+
+			continue
+		}
+
+		tokens = append(tokens, token{pixel: pix[i]})
+		insert(i)
+		i++
+	}
+
+	return tokens
+}
+
+// prefixEncode splits a length or distance value into the prefix symbol and
+// the extra bits that follow it.
+func prefixEncode(v int) (int, uint, uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+
+	highest := bits.Len(uint(d)) - 1
+	second := (d >> (highest - 1)) & 1
+	extraBits := uint(highest - 1)
+
+	return 2*highest + second, extraBits, uint32(d) & (1<<extraBits - 1)
+}
+
+// writeImageData writes the prefix codes followed by the entropy coded pixels.
+func writeImageData(bw *bitWriter, pix []uint32, useBackwardReferences bool) {
+	var tokens []token
+	if useBackwardReferences {
+		tokens = backwardReferences(pix)
+	} else {
+		tokens = make([]token, len(pix))
+		for i, p := range pix {
+			tokens[i] = token{pixel: p}
+		}
+	}
+
+	// Build the histograms for each of the five prefix codes.
+	histograms := [5][]uint32{
+		make([]uint32, numLiteralCodes+numLengthCodes),
+		make([]uint32, numLiteralCodes),
+		make([]uint32, numLiteralCodes),
+		make([]uint32, numLiteralCodes),
+		make([]uint32, numDistanceCodes),
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			histograms[0][t.pixel>>8&0xff]++
+			histograms[1][t.pixel>>16&0xff]++
+			histograms[2][t.pixel&0xff]++
+			histograms[3][t.pixel>>24]++
+			continue
+		}
+
+		lengthCode, _, _ := prefixEncode(t.length)
+		histograms[0][numLiteralCodes+lengthCode]++
+
+		distanceCode, _, _ := prefixEncode(t.distance + distanceCodeOffset)
+		histograms[4][distanceCode]++
+	}
+
+	var codes [5]prefixCode
+	for i, histogram := range histograms {
+		codes[i] = writePrefixCode(bw, histogram)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int(t.pixel>>8&0xff))
+			codes[1].write(bw, int(t.pixel>>16&0xff))
+			codes[2].write(bw, int(t.pixel&0xff))
+			codes[3].write(bw, int(t.pixel>>24))
+			continue
+		}
+
+		code, extraBits, extra := prefixEncode(t.length)
+		codes[0].write(bw, numLiteralCodes+code)
+		bw.write(extra, extraBits)
+
+		code, extraBits, extra = prefixEncode(t.distance + distanceCodeOffset)
+		codes[4].write(bw, code)
+		bw.write(extra, extraBits)
+	}
+}
+
+// =============================================================================
+
+// prefixCode is a canonical Huffman code stored with its bits reversed so it
+// can be written directly by the bitWriter.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// write writes the code for the symbol.
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// newPrefixCode computes the canonical codes for the given code lengths.
+func newPrefixCode(lengths []uint8) prefixCode {
+	var counts, next [maxCodeLength + 2]uint32
+	for _, l := range lengths {
+		counts[l]++
+	}
+	counts[0] = 0
+
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength+1; l++ {
+		code = (code + counts[l-1]) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[symbol] = bits.Reverse32(next[l]) >> (32 - uint(l))
+		next[l]++
+	}
+
+	return prefixCode{lengths: lengths, codes: codes}
+}
+
+// writePrefixCode writes the prefix code for the histogram and returns it.
+func writePrefixCode(bw *bitWriter, histogram []uint32) prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// Alphabets with at most two symbols below 256 can use the simple code.
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+		}
+
+		lengths := make([]uint8, len(histogram))
+		for _, symbol := range used {
+			lengths[symbol] = uint8(len(used) - 1)
+		}
+
+		return newPrefixCode(lengths)
+	}
+
+	lengths := huffmanLengths(histogram, maxCodeLength)
+	tokens := runLengthEncode(lengths)
+
+	// Build the code used to encode the code lengths.
+	var clHistogram [19]uint32
+	for _, t := range tokens {
+		clHistogram[t.symbol]++
+	}
+	clLengths := huffmanLengths(clHistogram[:], maxCodeLengthCodeLength)
+	clCode := newPrefixCode(clLengths)
+
+	numCodes := len(codeLengthCodeOrder)
+	for numCodes > 4 && clLengths[codeLengthCodeOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bw.write(0, 1)
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:numCodes] {
+		bw.write(uint32(clLengths[symbol]), 3)
+	}
+
+	// Code lengths are written for the entire alphabet.
+	bw.write(0, 1)
+
+	for _, t := range tokens {
+		clCode.write(bw, int(t.symbol))
+		switch t.symbol {
+		case 16:
+			bw.write(uint32(t.extra), 2)
+		case 17:
+			bw.write(uint32(t.extra), 3)
+		case 18:
+			bw.write(uint32(t.extra), 7)
+		}
+	}
+
+	return newPrefixCode(lengths)
+}
+
+// codeLengthToken is a symbol in the code length alphabet with its extra bits.
+type codeLengthToken struct {
+	symbol uint8
+	extra  uint8
+}
+
+// runLengthEncode compresses the code lengths using the repeat codes.
+func runLengthEncode(lengths []uint8) []codeLengthToken {
+	var tokens []codeLengthToken
+	previous := uint8(8)
+
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+
+		if value == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					r := min(run, 138)
+					tokens = append(tokens, codeLengthToken{18, uint8(r - 11)})
+					run -= r
+				} else {
+					r := min(run, 10)
+					tokens = append(tokens, codeLengthToken{17, uint8(r - 3)})
+					run -= r
+				}
+			}
+		} else {
+			if value != previous {
+				tokens = append(tokens, codeLengthToken{symbol: value})
+				previous = value
+				run--
+			}
+			for run >= 3 {
+				r := min(run, 6)
+				tokens = append(tokens, codeLengthToken{16, uint8(r - 3)})
+				run -= r
+			}
+		}
+
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{symbol: value})
+		}
+	}
+
+	return tokens
+}
+
+// huffmanLengths computes the Huffman code lengths for the histogram limited
+// to maxLength. When the limit is exceeded, the histogram is flattened by
+// raising the smallest counts until the code fits.
+func huffmanLengths(histogram []uint32, maxLength int) []uint8 {
+	type leaf struct {
+		symbol int
+		count  uint32
+	}
+
+	lengths := make([]uint8, len(histogram))
+
+	for minCount := uint32(1); ; minCount *= 2 {
+		var leaves []leaf
+		for symbol, count := range histogram {
+			if count > 0 {
+				leaves = append(leaves, leaf{symbol, max(count, minCount)})
+			}
+		}
+
+		// A code needs at least two symbols to be complete, so pair a lone
+		// symbol up with a neighbor that is never used.
+		if len(leaves) == 1 {
+			lengths[leaves[0].symbol] = 1
+			if leaves[0].symbol == 0 {
+				lengths[1] = 1
+			} else {
+				lengths[0] = 1
+			}
+
+			return lengths
+		}
+
+		sort.SliceStable(leaves, func(i, j int) bool {
+			return leaves[i].count < leaves[j].count
+		})
+
+		// Build the tree using the two queue method, the leaves occupy the
+		// first n nodes and the internal nodes follow in creation order.
+		n := len(leaves)
+		weights := make([]uint64, n, 2*n-1)
+		parents := make([]int, 2*n-1)
+		for i, l := range leaves {
+			weights[i] = uint64(l.count)
+		}
+
+		nextLeaf, nextInternal := 0, n
+		pick := func() int {
+			if nextLeaf < n && (nextInternal >= len(weights) || weights[nextLeaf] <= weights[nextInternal]) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextInternal++
+			return nextInternal - 1
+		}
+
+		for len(weights) < 2*n-1 {
+			a, b := pick(), pick()
+			parents[a], parents[b] = len(weights), len(weights)
+			weights = append(weights, weights[a]+weights[b])
+		}
+
+		depths := make([]int, 2*n-1)
+		longest := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depths[i] = depths[parents[i]] + 1
+			if i < n {
+				longest = max(longest, depths[i])
+			}
+		}
+
+		if longest > maxLength {
+			continue
+		}
+
+		for i, l := range leaves {
+			lengths[l.symbol] = uint8(depths[i])
+		}
+
+		return lengths
+	}
+}
+
+// =============================================================================
+
+// chunk is a chunk of a WebP RIFF container.
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+// writeRIFF wraps the chunks in a WebP RIFF container.
+func writeRIFF(chunks ...chunk) []byte {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+
+	out := make([]byte, 0, 8+size)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	out = append(out, "WEBP"...)
+
+	for _, c := range chunks {
+		out = append(out, c.fourCC...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(c.data)))
+		out = append(out, c.data...)
+		if len(c.data)&1 == 1 {
+			out = append(out, 0)
+		}
+	}
+
+	return out
+}
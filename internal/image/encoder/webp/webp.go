@@ -0,0 +1,108 @@
+package webp
+
+import (
+	"image"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	// Register the webp decoder so that webp sources can be decoded.
+	_ "golang.org/x/image/webp"
+)
+
+// defaultQuality is the quality of the image used when the quality param is
+// not provided.
+const defaultQuality = 75
+
+// NewEncoder creates a new Encoder based on the input request, this parses the
+// `quality` query variable to check to see if it needs to change the default
+// quality, and the `lossless` query variable to check to see if the image
+// should be encoded losslessly.
+func NewEncoder(r *http.Request) Encoder {
+	quality, err := strconv.Atoi(r.URL.Query().Get("quality"))
+	if err != nil || quality == 0 {
+		quality = defaultQuality
+	}
+
+	lossless, _ := strconv.ParseBool(r.URL.Query().Get("lossless"))
+
+	return Encoder{
+		Quality:  quality,
+		Lossless: lossless,
+	}
+}
+
+// Encoder allows the encoding of WebP's to a http.ResponseWriter. The images
+// are encoded with the lossy bitstream (VP8) at the Quality, or with the
+// lossless bitstream (VP8L) when Lossless is true.
+type Encoder struct {
+	Quality  int
+	Lossless bool
+}
+
+// Encode writes the encoded image data out to the http.ResponseWriter.
+func (e Encoder) Encode(i image.Image, w http.ResponseWriter) error {
+	var data []byte
+	var err error
+	if e.Lossless {
+		data, err = encodeLossless(i)
+	} else {
+		data, err = encodeLossy(i, e.Quality)
+	}
+	if err != nil {
+		return errors.Wrap(err, "can't encode the webp")
+	}
+
+	w.Header().Set("Content-Type", "image/webp")
+
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "can't write the webp")
+	}
+
+	return nil
+}
+
+// encodeLossless encodes the image as a WebP with the lossless bitstream.
+func encodeLossless(m image.Image) ([]byte, error) {
+	data, err := encodeVP8L(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeRIFF(chunk{"VP8L", data}), nil
+}
+
+// encodeLossy encodes the image as a WebP with the lossy bitstream at the
+// quality. The alpha values of images that are not opaque are encoded
+// losslessly in an alpha chunk, as the lossy bitstream can't hold them.
+func encodeLossy(m image.Image, quality int) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		quality = defaultQuality
+	}
+
+	width, height := m.Bounds().Dx(), m.Bounds().Dy()
+	pix, alpha := vp8Pixels(m)
+
+	data, err := encodeVP8(pix, width, height, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	if alpha == nil {
+		return writeRIFF(chunk{"VP8 ", data}), nil
+	}
+
+	// The extended format header has the alpha flag, and the width and height
+	// less one.
+	header := make([]byte, 10)
+	header[0] = 1 << 4
+	for i, v := range []int{width - 1, height - 1} {
+		header[4+3*i], header[5+3*i], header[6+3*i] = byte(v), byte(v>>8), byte(v>>16)
+	}
+
+	// The alpha values are compressed losslessly without filtering.
+	alphaData := append([]byte{1}, encodeAlpha(alpha, width, height)...)
+
+	return writeRIFF(chunk{"VP8X", header}, chunk{"ALPH", alphaData}, chunk{"VP8 ", data}), nil
+}
@@ -0,0 +1,202 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testImage creates an image with gradients, flat areas, noise and partial
+// transparency so that every part of the encoder is exercised.
+func testImage(width, height int) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255}
+			switch {
+			case x < width/4:
+				c = color.NRGBA{R: 10, G: 200, B: 30, A: 255}
+			case y > height*3/4:
+				c.R, c.G, c.B = uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256))
+			case x > width*3/4:
+				c.A = uint8(x + y)
+			}
+			m.SetNRGBA(x, y, c)
+		}
+	}
+
+	return m
+}
+
+func TestEncodeLossless(t *testing.T) {
+	sizes := []image.Point{{1, 1}, {2, 1}, {3, 7}, {33, 65}, {200, 150}}
+
+	for _, size := range sizes {
+		src := testImage(size.X, size.Y)
+
+		rr := httptest.NewRecorder()
+		if err := (Encoder{Lossless: true}).Encode(src, rr); err != nil {
+			t.Fatalf("Expected no error encoding %v, got %v", size, err)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != "image/webp" {
+			t.Errorf("Expected content type image/webp, got %s", ct)
+		}
+
+		m, err := webp.Decode(bytes.NewReader(rr.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("Expected no error decoding %v, got %v", size, err)
+		}
+
+		if m.Bounds() != src.Bounds() {
+			t.Fatalf("Expected bounds %v, got %v", src.Bounds(), m.Bounds())
+		}
+
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				expected := src.NRGBAAt(x, y)
+				got := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+				if expected.A == 0 {
+					continue
+				}
+				if expected != got {
+					t.Fatalf("Expected pixel %d,%d of %v to be %v, got %v", x, y, size, expected, got)
+				}
+			}
+		}
+	}
+}
+
+// lumaPSNR returns the peak signal to noise ratio of the luma of the decoded
+// image against the luma of the source.
+func lumaPSNR(src *image.NRGBA, m image.Image) float64 {
+	size := src.Bounds().Size()
+	mbw, mbh := (size.X+15)/16, (size.Y+15)/16
+
+	pix, _ := argbPixels(src)
+	expected, _, _ := yuvPlanes(pix, size.X, size.Y, mbw, mbh)
+
+	var y []uint8
+	var stride int
+	switch m := m.(type) {
+	case *image.YCbCr:
+		y, stride = m.Y, m.YStride
+	case *image.NYCbCrA:
+		y, stride = m.Y, m.YStride
+	default:
+		return 0
+	}
+
+	var sse float64
+	for j := 0; j < size.Y; j++ {
+		for i := 0; i < size.X; i++ {
+			d := float64(expected[j*mbw*16+i]) - float64(y[j*stride+i])
+			sse += d * d
+		}
+	}
+
+	if sse == 0 {
+		return math.Inf(1)
+	}
+
+	return 10 * math.Log10(255*255*float64(size.X*size.Y)/sse)
+}
+
+func TestEncodeLossy(t *testing.T) {
+	sizes := []image.Point{{1, 1}, {17, 9}, {33, 65}, {200, 150}}
+
+	for _, size := range sizes {
+		src := testImage(size.X, size.Y)
+
+		var lastSize int
+		var lastPSNR float64
+		for _, quality := range []int{10, 50, 75, 100} {
+			rr := httptest.NewRecorder()
+			if err := (Encoder{Quality: quality}).Encode(src, rr); err != nil {
+				t.Fatalf("Expected no error encoding %v, got %v", size, err)
+			}
+
+			data := rr.Body.Bytes()
+			m, err := webp.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Expected no error decoding %v at %d, got %v", size, quality, err)
+			}
+
+			if m.Bounds() != src.Bounds() {
+				t.Fatalf("Expected bounds %v, got %v", src.Bounds(), m.Bounds())
+			}
+
+			// The alpha values are encoded losslessly.
+			for y := 0; y < size.Y; y++ {
+				for x := 0; x < size.X; x++ {
+					if _, _, _, a := m.At(x, y).RGBA(); uint8(a>>8) != src.NRGBAAt(x, y).A {
+						t.Fatalf("Expected the alpha at %d,%d of %v to be %d, got %d", x, y, size, src.NRGBAAt(x, y).A, a>>8)
+					}
+				}
+			}
+
+			psnr := lumaPSNR(src, m)
+			if psnr < 25 {
+				t.Errorf("Expected the luma of %v at %d to be close to the source, got a PSNR of %.2f", size, quality, psnr)
+			}
+
+			if size.X > 16 && (len(data) <= lastSize || psnr <= lastPSNR) {
+				t.Errorf("Expected %v at %d to be larger and closer to the source than at the lower quality, got %d bytes and a PSNR of %.2f", size, quality, len(data), psnr)
+			}
+
+			lastSize, lastPSNR = len(data), psnr
+		}
+	}
+}
+
+func TestEncodeLossyOpaque(t *testing.T) {
+	src := testImage(64, 48)
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+
+	data, err := encodeLossy(src, 75)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if string(data[12:16]) != "VP8 " {
+		t.Errorf("Expected an opaque image to only have the VP8 chunk, got %q", data[12:16])
+	}
+
+	m, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if psnr := lumaPSNR(src, m); psnr < 30 {
+		t.Errorf("Expected the luma to be close to the source, got a PSNR of %.2f", psnr)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected Encoder
+	}{
+		{"", Encoder{Quality: 75}},
+		{"quality=40", Encoder{Quality: 40}},
+		{"lossless=true", Encoder{Quality: 75, Lossless: true}},
+		{"quality=90&lossless=false", Encoder{Quality: 90}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/image.png?"+tt.query, nil)
+		if e := NewEncoder(r); e != tt.expected {
+			t.Errorf("Expected %q to create %+v, got %+v", tt.query, tt.expected, e)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package exif provides the minimal EXIF parsing needed to orient images.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	// orientationTag is the EXIF tag that holds the image orientation.
+	orientationTag = 0x0112
+
+	// shortType is the TIFF field type for a 16-bit unsigned integer.
+	shortType = 3
+)
+
+// Orientation returns the EXIF orientation (1-8) stored in the JPEG or WebP
+// image data, or 1 (the default orientation) when none could be found.
+func Orientation(data []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		tiff = findJPEG(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		tiff = findWebP(data)
+	}
+
+	if orientation := parseTIFF(tiff); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+
+	return 1
+}
+
+// findJPEG returns the TIFF structure from the APP1 segment of a JPEG.
+func findJPEG(data []byte) []byte {
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			return nil
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte.
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd8):
+			// Standalone markers without a length.
+			i += 2
+			continue
+		case marker == 0xd9 || marker == 0xda:
+			// The end of the image or the start of the scan, no EXIF data will
+			// follow.
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+
+		i += 2 + length
+	}
+
+	return nil
+}
+
+// findWebP returns the TIFF structure from the EXIF chunk of a WebP.
+func findWebP(data []byte) []byte {
+	i := 12
+	for i+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			return nil
+		}
+
+		if string(data[i:i+4]) == "EXIF" {
+			// Some encoders include the JPEG APP1 header in the chunk.
+			return bytes.TrimPrefix(data[i+8:i+8+size], []byte("Exif\x00\x00"))
+		}
+
+		// Chunks are padded to an even size.
+		i += 8 + size + size&1
+	}
+
+	return nil
+}
+
+// parseTIFF returns the orientation stored in the first IFD of the TIFF
+// structure, or 0 if it was not present.
+func parseTIFF(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == shortType {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,78 @@
+package exif
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// tiffWithOrientation creates a TIFF structure with a single IFD entry holding
+// the orientation.
+func tiffWithOrientation(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], shortType)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	return tiff
+}
+
+// jpegWithTIFF wraps the TIFF structure in a JPEG APP1 segment.
+func jpegWithTIFF(tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	data := []byte{0xff, 0xd8}
+	// Add an unrelated APP0 segment first.
+	data = append(data, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00)
+	data = append(data, 0xff, 0xe1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(segment)+2))
+	data = append(data, segment...)
+	data = append(data, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9)
+
+	return data
+}
+
+// webpWithTIFF wraps the TIFF structure in a WebP EXIF chunk.
+func webpWithTIFF(tiff []byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	// Add an unrelated, odd sized chunk first.
+	data = append(data, "VP8X\x01\x00\x00\x00\x00\x00"...)
+	data = append(data, "EXIF"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(tiff)))
+	data = append(data, tiff...)
+
+	return data
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected int
+	}{
+		{"jpeg little endian", jpegWithTIFF(tiffWithOrientation(binary.LittleEndian, 6)), 6},
+		{"jpeg big endian", jpegWithTIFF(tiffWithOrientation(binary.BigEndian, 8)), 8},
+		{"jpeg invalid orientation", jpegWithTIFF(tiffWithOrientation(binary.BigEndian, 9)), 1},
+		{"jpeg without exif", []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9}, 1},
+		{"jpeg truncated", jpegWithTIFF(tiffWithOrientation(binary.BigEndian, 3))[:20], 1},
+		{"webp", webpWithTIFF(tiffWithOrientation(binary.LittleEndian, 3)), 3},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if orientation := Orientation(tt.data); orientation != tt.expected {
+				t.Errorf("Expected orientation %d, got %d", tt.expected, orientation)
+			}
+		})
+	}
+}
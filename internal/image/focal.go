@@ -0,0 +1,117 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+// maxSidecarBytes is the maximum size of a sidecar file.
+const maxSidecarBytes = 64 << 10
+
+// focalPointKey is the context key for the focal point of the source image.
+type focalPointKey struct{}
+
+// WithFocalPoint returns a copy of the context with the focal point of the
+// source image, which is used when the request does not provide one.
+func WithFocalPoint(ctx context.Context, focus *transform.FocalPoint) context.Context {
+	if focus == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, focalPointKey{}, focus)
+}
+
+// focalPoint parses the focal point from the fp-x and fp-y values, returning
+// nil when neither is provided or either is invalid.
+func focalPoint(x, y string) *transform.FocalPoint {
+	if x == "" && y == "" {
+		return nil
+	}
+
+	focus := &transform.FocalPoint{X: 0.5, Y: 0.5}
+	for _, axis := range []struct {
+		value string
+		field *float64
+	}{{x, &focus.X}, {y, &focus.Y}} {
+		if axis.value == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(axis.value, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil
+		}
+
+		*axis.field = f
+	}
+
+	return focus
+}
+
+// sidecar is the content of a sidecar file.
+type sidecar struct {
+	X json.Number `json:"fp-x"`
+	Y json.Number `json:"fp-y"`
+}
+
+// loadSidecar loads the focal point from the sidecar file of the image. Images
+// without a sidecar file do not have a focal point.
+func loadSidecar(ctx context.Context, p provider.Provider, filename string) (*transform.FocalPoint, error) {
+	rc, err := p.Provide(ctx, filename)
+	if err != nil {
+		if errors.Is(err, provider.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "can't load the sidecar")
+	}
+	defer rc.Close()
+
+	var s sidecar
+	if err := json.NewDecoder(io.LimitReader(rc, maxSidecarBytes)).Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "can't decode the sidecar")
+	}
+
+	focus := focalPoint(s.X.String(), s.Y.String())
+	if focus == nil && (s.X != "" || s.Y != "") {
+		return nil, errors.New("the sidecar has an invalid focal point")
+	}
+
+	return focus, nil
+}
+
+// SourceFocalPoint returns the focal point of the source image from the
+// `fp-x` and `fp-y` metadata of the object, or from the sidecar file next to
+// it when opts.FocalPointSidecar is provided. Nil is returned when the focal
+// point is not known, the options provide their own, or the options don't crop
+// the image so that the sidecar file is only loaded when it's used.
+func SourceFocalPoint(ctx context.Context, opts *ProcessOpts, o *transform.Options, p provider.Provider, filename string, source *provider.Object) *transform.FocalPoint {
+	if o.Focus != nil || !o.Cropped() {
+		return nil
+	}
+
+	if focus := focalPoint(source.Metadata["fp-x"], source.Metadata["fp-y"]); focus != nil {
+		return focus
+	}
+
+	// The proxy provider loads arbitrary urls, so they don't have sidecar
+	// files.
+	if _, ok := p.(*provider.Proxy); ok || opts.FocalPointSidecar == "" {
+		return nil
+	}
+
+	focus, err := loadSidecar(ctx, p, filename+opts.FocalPointSidecar)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Warn("could not load the focal point")
+		return nil
+	}
+
+	return focus
+}
@@ -0,0 +1,80 @@
+package image
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+func TestSourceFocalPoint(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"image.jpg.json":   `{"fp-x": 0.25, "fp-y": 0.75}`,
+		"invalid.jpg.json": `{"fp-x": 2}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write the sidecar: %v", err)
+		}
+	}
+
+	p := &provider.Filesystem{Dir: http.Dir(dir)}
+
+	tests := []struct {
+		name     string
+		query    string
+		filename string
+		metadata map[string]string
+		suffix   string
+		expected *transform.FocalPoint
+	}{
+		{"none", "width=100&height=100&fit=crop", "image.jpg", nil, "", nil},
+		{"metadata", "width=100&height=100&fit=crop", "image.jpg", map[string]string{"fp-x": "0.1"}, ".json", &transform.FocalPoint{X: 0.1, Y: 0.5}},
+		{"sidecar", "width=100&height=100&fit=crop", "image.jpg", nil, ".json", &transform.FocalPoint{X: 0.25, Y: 0.75}},
+		{"sidecar with crop", "crop=1:1", "image.jpg", nil, ".json", &transform.FocalPoint{X: 0.25, Y: 0.75}},
+		{"sidecar disabled", "width=100&height=100&fit=crop", "image.jpg", nil, "", nil},
+		{"missing sidecar", "width=100&height=100&fit=crop", "other.jpg", nil, ".json", nil},
+		{"invalid sidecar", "width=100&height=100&fit=crop", "invalid.jpg", nil, ".json", nil},
+		{"invalid metadata", "width=100&height=100&fit=crop", "image.jpg", map[string]string{"fp-x": "abc"}, ".json", &transform.FocalPoint{X: 0.25, Y: 0.75}},
+		{"provided by the request", "width=100&height=100&fit=crop&fp-x=0.9", "image.jpg", map[string]string{"fp-x": "0.1"}, ".json", nil},
+		{"not cropped", "width=100", "image.jpg", map[string]string{"fp-x": "0.1"}, ".json", nil},
+		{"positioned crop", "crop=10,10,x0,y0", "image.jpg", nil, ".json", nil},
+		{"bounds", "width=100&height=100&fit=bounds", "image.jpg", nil, ".json", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/"+tt.filename+"?"+tt.query, nil)
+			opts := &ProcessOpts{FocalPointSidecar: tt.suffix}
+
+			o, err := ParseOptions(opts, r)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			focus := SourceFocalPoint(context.Background(), opts, o, p, tt.filename, &provider.Object{Metadata: tt.metadata})
+			if (focus == nil) != (tt.expected == nil) || (focus != nil && *focus != *tt.expected) {
+				t.Errorf("Expected the focal point %v, got %v", tt.expected, focus)
+			}
+		})
+	}
+}
+
+func TestParseOptionsFocalPoint(t *testing.T) {
+	r := httptest.NewRequest("GET", "/image.jpg", nil)
+	r = r.WithContext(WithFocalPoint(r.Context(), &transform.FocalPoint{X: 0.1, Y: 0.2}))
+
+	o, err := ParseOptions(&ProcessOpts{}, r)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if o.Focus == nil || *o.Focus != (transform.FocalPoint{X: 0.1, Y: 0.2}) {
+		t.Errorf("Expected the focal point from the context, got %v", o.Focus)
+	}
+}
@@ -1,42 +1,167 @@
 package image
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"image"
+	"image/gif"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/wyattjoh/ims/internal/image/encoder"
+	gifencoder "github.com/wyattjoh/ims/internal/image/encoder/gif"
+	"github.com/wyattjoh/ims/internal/image/exif"
 	"github.com/wyattjoh/ims/internal/image/transform"
+	"github.com/wyattjoh/ims/internal/platform/limiter"
 )
 
+// ProcessOpts is the options used when processing images.
+type ProcessOpts struct {
+	// CacheTimeout is the time that images will have cache headers for when
+	// writing them out to the http response.
+	CacheTimeout time.Duration
+
+	// DisableAutoOrient disables orienting images based on their EXIF
+	// orientation tag unless requested with `orient=1`.
+	DisableAutoOrient bool
+
+	// Limits are the limits applied to the source images before they are
+	// decoded.
+	Limits Limits
+
+	// Limiter limits the number of images that are decoded, transformed, and
+	// encoded concurrently. When nil, images are not limited.
+	Limiter *limiter.Limiter
+
+	// OriginCacheControl enables using the Cache-Control and Expires headers
+	// of the source image for the processed image instead of the CacheTimeout.
+	OriginCacheControl bool
+
+	// MinCacheTimeout is the minimum max age used when it's provided by the
+	// source image, where zero will not limit it.
+	MinCacheTimeout time.Duration
+
+	// MaxCacheTimeout is the maximum max age used when it's provided by the
+	// source image, where zero will not limit it.
+	MaxCacheTimeout time.Duration
+
+	// StaleWhileRevalidate is the time that a stale processed image may be
+	// served while it's revalidated in the background, unless provided by the
+	// source image.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the time that a stale processed image may be served when
+	// an error occurs, unless provided by the source image.
+	StaleIfError time.Duration
+
+	// StrictParams rejects requests with query parameters that are not used by
+	// ims.
+	StrictParams bool
+
+	// FocalPointSidecar is the suffix of the sidecar file that is loaded with
+	// the source image to provide its focal point, where empty will not load
+	// them.
+	FocalPointSidecar string
+
+	// ClientHints enables requesting the client hints from clients, which are
+	// used as the parameters by the clienthints middleware.
+	ClientHints bool
+
+	// Overlays loads the overlay images, where nil will load them from the
+	// provider of the host without keeping them in memory.
+	Overlays *Overlays
+}
+
 // Process uses the github.com/disintegration/imaging lib to perform the
 // image transformations.
-func Process(ctx context.Context, timeout time.Duration, input io.Reader, w http.ResponseWriter, r *http.Request) error {
+func Process(ctx context.Context, opts *ProcessOpts, input io.Reader, w http.ResponseWriter, r *http.Request) error {
 	start := time.Now()
 
 	logrus.Debug("starting processing image")
 
+	// Parse the options before reading the image so that invalid requests are
+	// rejected without doing any work.
+	o, err := ParseOptions(opts, r)
+	if err != nil {
+		return errors.Wrap(err, "can't parse the options")
+	}
+
 	// Decode the image from the reader.
 	span, ctx := opentracing.StartSpanFromContext(ctx, "internal.image.Process.Decode")
 
-	m, format, err := image.Decode(input)
+	// Wait for a turn to process the image before it's read, as reading,
+	// decoding and transforming it is expensive, and the images waiting for
+	// their turn should not hold their source in memory.
+	release, err := opts.Limiter.Acquire(ctx)
+	if err != nil {
+		span.Finish()
+		return errors.Wrap(err, "can't process the image")
+	}
+	defer release()
+
+	data, err := opts.Limits.read(input)
+	if err != nil {
+		span.Finish()
+		return errors.Wrap(err, "can't read the image")
+	}
+
+	// Check the dimensions from the image header before decoding it, as the
+	// decoded image may use far more memory than the source.
+	if err := opts.Limits.check(data); err != nil {
+		span.Finish()
+		return errors.Wrap(err, "can't decode the image")
+	}
+
+	m, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		span.Finish()
 		return errors.Wrap(err, "can't decode the image")
 	}
 
+	// Animated GIFs keep all of their frames when they are also encoded as a
+	// GIF, unless only the first frame was requested with `frame=1`.
+	var animation *gif.GIF
+	if format == "gif" && encoder.Format(format, r) == "gif" && r.URL.Query().Get("frame") != "1" {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			span.Finish()
+			return errors.Wrap(err, "can't decode the animated image")
+		}
+
+		if len(g.Image) > 1 {
+			if err := opts.Limits.checkAnimation(g); err != nil {
+				span.Finish()
+				return errors.Wrap(err, "can't decode the animated image")
+			}
+
+			animation = g
+		}
+	}
+
+	// Orient the image based on the EXIF data before any other transformations
+	// are applied so they operate on the image as it's meant to be displayed.
+	if !opts.DisableAutoOrient || r.URL.Query().Get("orient") == "1" {
+		if orientation := exif.Orientation(data); orientation != 1 {
+			m = transform.RotateImage(m, strconv.Itoa(orientation))
+		}
+	}
+
 	span.Finish()
 
 	// Apply image transformations.
 	span, ctx = opentracing.StartSpanFromContext(ctx, "internal.image.Process.Transform")
 
-	tm, err := transform.Image(m, r.URL.Query())
+	var tm image.Image
+	if animation != nil {
+		animation, err = transform.Animation(animation, o)
+	} else {
+		tm, err = transform.Image(m, o)
+	}
 	if err != nil {
 		span.Finish()
 		return errors.Wrap(err, "could not transform image")
@@ -44,20 +169,14 @@ func Process(ctx context.Context, timeout time.Duration, input io.Reader, w http
 
 	span.Finish()
 
-	now := time.Now()
-
-	// Write some caching headers if needed.
-	if timeout != 0 {
-		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(timeout.Seconds())))
-		w.Header().Set("Expires", now.Add(timeout).Format(http.TimeFormat))
-	}
-
-	w.Header().Set("Last-Modified", now.Format(http.TimeFormat))
-
 	span, _ = opentracing.StartSpanFromContext(ctx, "internal.image.Process.Encode")
 
-	enc := encoder.Get(format, r)
-	if err := enc.Encode(tm, w); err != nil {
+	if animation != nil {
+		err = gifencoder.EncodeAll(animation, w)
+	} else {
+		err = encoder.Get(format, r).Encode(tm, w)
+	}
+	if err != nil {
 		span.Finish()
 		return errors.Wrap(err, "can't encode the image")
 	}
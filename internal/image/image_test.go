@@ -0,0 +1,235 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/platform/limiter"
+)
+
+// jpegWithOrientation encodes a JPEG with the given dimensions and an EXIF
+// orientation tag.
+func jpegWithOrientation(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatalf("Failed to encode jpeg: %v", err)
+	}
+
+	// Build a big endian TIFF structure with a single orientation entry.
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	// Insert the APP1 segment directly after the SOI marker.
+	data := []byte{0xff, 0xd8, 0xff, 0xe1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(segment)+2))
+	data = append(data, segment...)
+
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func TestProcessAutoOrient(t *testing.T) {
+	tests := []struct {
+		name              string
+		query             string
+		orientation       uint16
+		disableAutoOrient bool
+		expected          image.Point
+	}{
+		{"rotated", "", 6, false, image.Point{10, 20}},
+		{"flipped", "", 2, false, image.Point{20, 10}},
+		{"disabled", "", 6, true, image.Point{20, 10}},
+		{"disabled with orient", "orient=1", 8, true, image.Point{10, 20}},
+		{"rotated and resized", "width=5", 6, false, image.Point{5, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := bytes.NewReader(jpegWithOrientation(t, 20, 10, tt.orientation))
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			opts := &ProcessOpts{DisableAutoOrient: tt.disableAutoOrient}
+			if err := Process(context.Background(), opts, input, rr, r); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			m, _, err := image.Decode(rr.Body)
+			if err != nil {
+				t.Fatalf("Expected no error decoding output, got %v", err)
+			}
+
+			if size := m.Bounds().Size(); size != tt.expected {
+				t.Errorf("Expected size %v, got %v", tt.expected, size)
+			}
+		})
+	}
+}
+
+// animatedGIF encodes a three frame animation where each frame only updates a
+// part of the canvas.
+func animatedGIF(t *testing.T) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White, color.RGBA{R: 0xff, A: 0xff}}
+	g := &gif.GIF{
+		Config:    image.Config{Width: 40, Height: 20, ColorModel: palette},
+		LoopCount: 3,
+	}
+
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(i*10, 0, i*10+20, 20), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10*(i+1))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("Failed to encode gif: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestProcessAnimation(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		frames      int
+	}{
+		{"animated", "width=20", "image/gif", 3},
+		{"first frame", "width=20&frame=1", "image/gif", 1},
+		{"other format", "width=20&format=png", "image/png", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := bytes.NewReader(animatedGIF(t))
+			r := httptest.NewRequest("GET", "/image.gif?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			if err := Process(context.Background(), &ProcessOpts{}, input, rr, r); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Fatalf("Expected content type %s, got %s", tt.contentType, ct)
+			}
+
+			if tt.frames == 0 {
+				return
+			}
+
+			g, err := gif.DecodeAll(rr.Body)
+			if err != nil {
+				t.Fatalf("Expected no error decoding output, got %v", err)
+			}
+
+			if len(g.Image) != tt.frames {
+				t.Fatalf("Expected %d frames, got %d", tt.frames, len(g.Image))
+			}
+
+			if tt.frames == 1 {
+				return
+			}
+
+			if g.LoopCount != 3 {
+				t.Errorf("Expected loop count 3, got %d", g.LoopCount)
+			}
+
+			for i, frame := range g.Image {
+				if size := frame.Bounds().Size(); size != (image.Point{20, 10}) {
+					t.Errorf("Expected frame %d to have size 20x10, got %v", i, size)
+				}
+
+				if g.Delay[i] != 10*(i+1) {
+					t.Errorf("Expected frame %d to have delay %d, got %d", i, 10*(i+1), g.Delay[i])
+				}
+			}
+
+			// The last frame was drawn over the earlier frames, so the left
+			// side should still show the first frame.
+			last := g.Image[2]
+			if c := last.At(0, 5); c != last.Palette.Convert(color.Black) {
+				t.Errorf("Expected the left edge of the last frame to be black, got %v", c)
+			}
+			if c := last.At(19, 5); c != last.Palette.Convert(color.RGBA{R: 0xff, A: 0xff}) {
+				t.Errorf("Expected the right edge of the last frame to be red, got %v", c)
+			}
+		})
+	}
+}
+
+// readCounter counts the reads from the reader.
+type readCounter struct {
+	io.Reader
+	reads atomic.Int32
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	return r.Reader.Read(p)
+}
+
+func TestProcessLimiter(t *testing.T) {
+	l := limiter.New(1, 1)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Failed to encode png: %v", err)
+	}
+
+	input := &readCounter{Reader: &buf}
+	done := make(chan error)
+	go func() {
+		done <- Process(context.Background(), &ProcessOpts{Limiter: l}, input, httptest.NewRecorder(), httptest.NewRequest("GET", "/image.png", nil))
+	}()
+
+	// The source is not read while the image waits for its turn.
+	deadline := time.Now().Add(time.Second)
+	for l.Queued() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the image to be queued, it was not")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if reads := input.reads.Load(); reads != 0 {
+		t.Errorf("Expected the source to not be read while queued, got %d reads", reads)
+	}
+
+	release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if input.reads.Load() == 0 {
+		t.Errorf("Expected the source to be read once it was processed")
+	}
+}
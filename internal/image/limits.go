@@ -0,0 +1,147 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when the source image is not in a
+	// format that can be decoded.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrSourceTooLarge is returned when the source image has more bytes than
+	// permitted.
+	ErrSourceTooLarge = errors.New("source image too large")
+
+	// ErrDimensionsTooLarge is returned when the source image has dimensions
+	// larger than permitted.
+	ErrDimensionsTooLarge = errors.New("source image dimensions too large")
+)
+
+// Limits are the limits applied to the source images before they are decoded
+// to protect against images that would use excessive resources to process. A
+// zero value disables the limit.
+type Limits struct {
+	// MaxWidth is the maximum width of the source image in pixels.
+	MaxWidth int
+
+	// MaxHeight is the maximum height of the source image in pixels.
+	MaxHeight int
+
+	// MaxMegapixels is the maximum number of pixels in the source image in
+	// millions.
+	MaxMegapixels float64
+
+	// MaxBytes is the maximum size of the source image in bytes.
+	MaxBytes int64
+}
+
+// CheckSource checks the content type and size of the source image reported
+// by the provider before it's read, where empty or zero values are unknown and
+// are not checked.
+func CheckSource(opts *ProcessOpts, contentType string, size int64) error {
+	if opts.Limits.MaxBytes != 0 && size > opts.Limits.MaxBytes {
+		return errors.Wrapf(ErrSourceTooLarge, "%d bytes exceeds %d bytes", size, opts.Limits.MaxBytes)
+	}
+
+	if !isImageContentType(contentType) {
+		return errors.Wrapf(ErrUnsupportedFormat, "content type %s", contentType)
+	}
+
+	return nil
+}
+
+// isImageContentType returns true when the content type could be an image.
+// Generic binary content types are permitted as many storage providers use
+// them when the content type was not specified.
+func isImageContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/octet-stream", "binary/octet-stream":
+		return true
+	default:
+		return strings.HasPrefix(mediaType, "image/")
+	}
+}
+
+// read reads the source image, returning ErrSourceTooLarge if it has more
+// bytes than permitted.
+func (l *Limits) read(input io.Reader) ([]byte, error) {
+	if l.MaxBytes == 0 {
+		return io.ReadAll(input)
+	}
+
+	// Read one more byte than permitted to detect when the source is too large
+	// without reading all of it.
+	data, err := io.ReadAll(io.LimitReader(input, l.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > l.MaxBytes {
+		return nil, errors.Wrapf(ErrSourceTooLarge, "exceeds %d bytes", l.MaxBytes)
+	}
+
+	return data, nil
+}
+
+// check reads the dimensions from the header of the source image, returning
+// ErrDimensionsTooLarge if they are larger than permitted.
+func (l *Limits) check(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if l.MaxWidth != 0 && config.Width > l.MaxWidth {
+		return errors.Wrapf(ErrDimensionsTooLarge, "width %d exceeds %d", config.Width, l.MaxWidth)
+	}
+
+	if l.MaxHeight != 0 && config.Height > l.MaxHeight {
+		return errors.Wrapf(ErrDimensionsTooLarge, "height %d exceeds %d", config.Height, l.MaxHeight)
+	}
+
+	if l.MaxMegapixels != 0 && float64(config.Width)*float64(config.Height) > l.MaxMegapixels*1e6 {
+		return errors.Wrapf(ErrDimensionsTooLarge, "%dx%d exceeds %g megapixels", config.Width, config.Height, l.MaxMegapixels)
+	}
+
+	return nil
+}
+
+// checkAnimation returns ErrDimensionsTooLarge if the canvas of the animation
+// is larger than permitted, or if its frames have more pixels in total than
+// permitted, as every frame is rendered onto its own copy of the canvas and
+// held in memory while they are transformed.
+func (l *Limits) checkAnimation(g *gif.GIF) error {
+	bounds := transform.CanvasBounds(g)
+
+	if l.MaxWidth != 0 && bounds.Dx() > l.MaxWidth {
+		return errors.Wrapf(ErrDimensionsTooLarge, "width %d exceeds %d", bounds.Dx(), l.MaxWidth)
+	}
+
+	if l.MaxHeight != 0 && bounds.Dy() > l.MaxHeight {
+		return errors.Wrapf(ErrDimensionsTooLarge, "height %d exceeds %d", bounds.Dy(), l.MaxHeight)
+	}
+
+	if l.MaxMegapixels != 0 && float64(bounds.Dx())*float64(bounds.Dy())*float64(len(g.Image)) > l.MaxMegapixels*1e6 {
+		return errors.Wrapf(ErrDimensionsTooLarge, "%d frames of %dx%d exceeds %g megapixels", len(g.Image), bounds.Dx(), bounds.Dy(), l.MaxMegapixels)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// pngHeader returns the signature and header chunk of a PNG that declares the
+// given dimensions, which is all that is needed to decode its config.
+func pngHeader(width, height uint32) []byte {
+	chunk := []byte("IHDR")
+	chunk = binary.BigEndian.AppendUint32(chunk, width)
+	chunk = binary.BigEndian.AppendUint32(chunk, height)
+	chunk = append(chunk, 8, 2, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(chunk)-4))
+	data = append(data, chunk...)
+
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   Limits
+		data     []byte
+		expected error
+	}{
+		{"no limits", Limits{}, pngHeader(60000, 60000), nil},
+		{"within the limits", Limits{MaxWidth: 100, MaxHeight: 100, MaxMegapixels: 0.01, MaxBytes: 100}, pngHeader(100, 100), nil},
+		{"too wide", Limits{MaxWidth: 100}, pngHeader(101, 1), ErrDimensionsTooLarge},
+		{"too tall", Limits{MaxHeight: 100}, pngHeader(1, 101), ErrDimensionsTooLarge},
+		{"too many pixels", Limits{MaxMegapixels: 100}, pngHeader(60000, 60000), ErrDimensionsTooLarge},
+		{"too many bytes", Limits{MaxBytes: 32}, pngHeader(1, 1), ErrSourceTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.limits.read(bytes.NewReader(tt.data))
+			if err == nil {
+				err = tt.limits.check(data)
+			}
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestLimitsAnimation(t *testing.T) {
+	// The logical screen is much larger than the frames, which are each
+	// rendered onto a copy of it.
+	frames := func(count, width, height int) *gif.GIF {
+		g := &gif.GIF{Config: image.Config{Width: width, Height: height}}
+		for i := 0; i < count; i++ {
+			g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}))
+		}
+
+		return g
+	}
+
+	tests := []struct {
+		name     string
+		limits   Limits
+		g        *gif.GIF
+		expected error
+	}{
+		{"no limits", Limits{}, frames(500, 4000, 4000), nil},
+		{"within the limits", Limits{MaxMegapixels: 1}, frames(100, 100, 100), nil},
+		{"too many pixels", Limits{MaxMegapixels: 100}, frames(500, 4000, 4000), ErrDimensionsTooLarge},
+		{"too wide", Limits{MaxWidth: 100}, frames(2, 101, 1), ErrDimensionsTooLarge},
+		{"frames without a screen", Limits{MaxHeight: 100}, &gif.GIF{Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 1, 200), nil), image.NewPaletted(image.Rect(0, 0, 1, 1), nil)}}, ErrDimensionsTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limits.checkAnimation(tt.g); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package image
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"image"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+const (
+	// maxOverlayBytes is the maximum number of bytes used by the decoded
+	// overlay images kept in memory.
+	maxOverlayBytes = 64 << 20
+
+	// overlayTimeout is the time that an overlay image is kept in memory
+	// before it's loaded again.
+	overlayTimeout = 5 * time.Minute
+)
+
+// overlayKey identifies an overlay image by the provider it's loaded from.
+type overlayKey struct {
+	p        provider.Provider
+	filename string
+}
+
+// overlayItem is the element stored in the recency list.
+type overlayItem struct {
+	key     overlayKey
+	m       image.Image
+	version string
+	size    int64
+	expires time.Time
+}
+
+// imageSize returns the approximate number of bytes used by the decoded image.
+func imageSize(m image.Image) int64 {
+	switch m := m.(type) {
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix) + len(m.Palette)*4)
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	default:
+		size := m.Bounds().Size()
+		return int64(size.X) * int64(size.Y) * 4
+	}
+}
+
+// Overlays loads the overlay images, keeping the most recently used ones in
+// memory as the same overlay is usually used for many images.
+type Overlays struct {
+	// Provider loads the overlay images instead of the provider of the host
+	// when it's not nil.
+	Provider provider.Provider
+
+	mu    sync.Mutex
+	bytes int64
+	items map[overlayKey]*list.Element
+	order *list.List
+}
+
+// NewOverlays creates a new Overlays that loads the overlay images from the
+// provider, or from the provider of the host when it's nil.
+func NewOverlays(p provider.Provider) *Overlays {
+	return &Overlays{
+		Provider: p,
+		items:    make(map[overlayKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the overlay image stored with the key and its version, and marks
+// it as recently used.
+func (o *Overlays) get(key overlayKey) (image.Image, string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	el, ok := o.items[key]
+	if !ok {
+		return nil, "", false
+	}
+
+	item := el.Value.(*overlayItem)
+	if time.Now().After(item.expires) {
+		o.remove(el)
+		return nil, "", false
+	}
+
+	o.order.MoveToFront(el)
+
+	return item.m, item.version, true
+}
+
+// set stores the overlay image with its version, evicting the least recently
+// used overlay images until they fit within maxOverlayBytes. Overlay images
+// larger than the budget are not stored.
+func (o *Overlays) set(key overlayKey, m image.Image, version string) {
+	size := imageSize(m)
+	if size > maxOverlayBytes {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if el, ok := o.items[key]; ok {
+		o.remove(el)
+	}
+
+	o.items[key] = o.order.PushFront(&overlayItem{key: key, m: m, version: version, size: size, expires: time.Now().Add(overlayTimeout)})
+	o.bytes += size
+
+	for o.bytes > maxOverlayBytes {
+		o.remove(o.order.Back())
+	}
+}
+
+// remove removes the element from the overlay images, the lock must be held.
+func (o *Overlays) remove(el *list.Element) {
+	item := o.order.Remove(el).(*overlayItem)
+	delete(o.items, item.key)
+	o.bytes -= item.size
+}
+
+// Load returns the overlay image with the filename and its version (see
+// provider.Object.Version), loading it from the provider when it's not in
+// memory. The limits of the source images also apply to the overlay images.
+func (o *Overlays) Load(ctx context.Context, p provider.Provider, filename string, limits Limits) (image.Image, string, error) {
+	if o.Provider != nil {
+		p = o.Provider
+	}
+
+	key := overlayKey{p: p, filename: filename}
+	if m, version, ok := o.get(key); ok {
+		return m, version, nil
+	}
+
+	obj, err := provider.ProvideObject(ctx, p, filename)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "can't load the overlay")
+	}
+	defer obj.Close()
+
+	data, err := limits.read(obj)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "can't read the overlay")
+	}
+
+	// Overlays that are not images are reported as unsupported, as they are
+	// chosen by the request.
+	if err := limits.check(data); errors.Is(err, ErrDimensionsTooLarge) {
+		return nil, "", errors.Wrap(err, "can't decode the overlay")
+	} else if err != nil {
+		return nil, "", errors.Wrapf(ErrUnsupportedFormat, "can't decode the overlay: %v", err)
+	}
+
+	m, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.Wrapf(ErrUnsupportedFormat, "can't decode the overlay: %v", err)
+	}
+
+	version := obj.Version()
+	o.set(key, m, version)
+
+	return m, version, nil
+}
+
+// =============================================================================
+
+// overlayImageKey is the context key for the overlay image.
+type overlayImageKey struct{}
+
+// WithOverlay returns a copy of the context with the overlay image, which is
+// composited over the image when the request provides an overlay.
+func WithOverlay(ctx context.Context, m image.Image) context.Context {
+	if m == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, overlayImageKey{}, m)
+}
+
+// LoadOverlay loads the overlay image provided by the `overlay` parameter of
+// the request with opts.Overlays, returning nil when the request does not
+// provide one, along with its version. Overlays that can't be found or decoded
+// are reported as a transform.ParamErrors.
+func LoadOverlay(ctx context.Context, opts *ProcessOpts, p provider.Provider, r *http.Request) (image.Image, string, error) {
+	filename := r.URL.Query().Get("overlay")
+	if filename == "" {
+		return nil, "", nil
+	}
+
+	overlays := opts.Overlays
+	if overlays == nil {
+		overlays = NewOverlays(nil)
+	}
+
+	m, version, err := overlays.Load(ctx, p, filename, opts.Limits)
+	if err != nil {
+		var message string
+		switch {
+		case errors.Is(err, provider.ErrNotFound), errors.Is(err, provider.ErrFilename):
+			message = "could not be found"
+		case errors.Is(err, ErrUnsupportedFormat):
+			message = "is not a supported image"
+		case errors.Is(err, ErrSourceTooLarge), errors.Is(err, ErrDimensionsTooLarge):
+			message = "is too large"
+		default:
+			return nil, "", err
+		}
+
+		return nil, "", transform.ParamErrors{&transform.ParamError{
+			Param:   "overlay",
+			Value:   filename,
+			Message: message,
+		}}
+	}
+
+	return m, version, nil
+}
@@ -0,0 +1,145 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wyattjoh/ims/internal/image/provider"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+// countingProvider counts the files that were provided.
+type countingProvider struct {
+	provider.Provider
+	count int
+}
+
+func (p *countingProvider) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	p.count++
+	return p.Provider.Provide(ctx, filename)
+}
+
+func TestLoadOverlay(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, "logo.png"))
+	if err != nil {
+		t.Fatalf("Failed to create the overlay: %v", err)
+	}
+
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("Failed to encode the overlay: %v", err)
+	}
+	f.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "logo.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+
+	p := &countingProvider{Provider: &provider.Filesystem{Dir: http.Dir(dir)}}
+	opts := &ProcessOpts{Overlays: NewOverlays(nil)}
+
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"none", "", ""},
+		{"overlay", "overlay=logo.png", ""},
+		{"missing", "overlay=missing.png", "could not be found"},
+		{"not an image", "overlay=logo.txt", "is not a supported image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+
+			m, _, err := LoadOverlay(context.Background(), opts, p, r)
+			if tt.message != "" {
+				var params transform.ParamErrors
+				if !errors.As(err, &params) || params[0].Message != tt.message {
+					t.Fatalf("Expected the message %q, got %v", tt.message, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if (m == nil) != (tt.query == "") {
+				t.Errorf("Expected the overlay to be loaded when it's provided, got %v", m)
+			}
+		})
+	}
+
+	// The overlay is kept in memory after it's first loaded.
+	count := p.count
+	r := httptest.NewRequest("GET", "/image.jpg?overlay=logo.png", nil)
+	if _, _, err := LoadOverlay(context.Background(), opts, p, r); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if p.count != count {
+		t.Errorf("Expected the overlay to be loaded from memory, got %d loads", p.count-count)
+	}
+
+	// The overlay provider is used instead of the provider of the host.
+	overlays := &countingProvider{Provider: p.Provider}
+	opts.Overlays = NewOverlays(overlays)
+	if _, _, err := LoadOverlay(context.Background(), opts, p, r); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if overlays.count != 1 || p.count != count {
+		t.Errorf("Expected the overlay to be loaded from the overlay provider")
+	}
+
+	// The version of the overlay is known when the provider reports it, and is
+	// kept with the overlay in memory.
+	opts.Overlays = NewOverlays(nil)
+	for i := 0; i < 2; i++ {
+		_, version, err := LoadOverlay(context.Background(), opts, p.Provider, r)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if version == "" {
+			t.Errorf("Expected the overlay to have a version, it did not")
+		}
+	}
+}
+
+func TestOverlaysEviction(t *testing.T) {
+	o := NewOverlays(nil)
+
+	// Each overlay uses a quarter of the budget.
+	m := image.NewNRGBA(image.Rect(0, 0, 1024, maxOverlayBytes/1024/4/4))
+
+	for i := 0; i < 5; i++ {
+		o.set(overlayKey{filename: string(rune('a' + i))}, m, "")
+	}
+
+	if _, _, ok := o.get(overlayKey{filename: "a"}); ok {
+		t.Errorf("Expected the least recently used overlay to be evicted")
+	}
+
+	if len(o.items) != 4 || o.order.Len() != 4 || o.bytes != maxOverlayBytes {
+		t.Errorf("Expected 4 overlays using %d bytes, got %d using %d", maxOverlayBytes, len(o.items), o.bytes)
+	}
+
+	// Overlays larger than the budget are not kept.
+	o.set(overlayKey{filename: "large"}, image.NewNRGBA(image.Rect(0, 0, 1024, maxOverlayBytes/1024/4+1)), "")
+	if _, _, ok := o.get(overlayKey{filename: "large"}); ok {
+		t.Errorf("Expected the overlay larger than the budget to not be kept")
+	}
+}
@@ -0,0 +1,151 @@
+package image
+
+import (
+	"image"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/wyattjoh/ims/internal/image/encoder"
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+// params are the query parameters used by ims that are not used by the
+// transformations.
+var params = []string{
+	"format",
+	"auto",
+	"quality",
+	"lossless",
+	"frame",
+	"sig",
+	"url",
+}
+
+// normalizers put the values of the numeric parameters in a canonical form,
+// parsing them like the parameters are parsed so that only the values that
+// are equivalent when they're used are made the same.
+var normalizers = map[string]func(string) string{
+	"width":           normalizeInt,
+	"height":          normalizeInt,
+	"quality":         normalizeInt,
+	"lossless":        normalizeBool,
+	"dpr":             normalizeNumber,
+	"fp-x":            normalizeNumber,
+	"fp-y":            normalizeNumber,
+	"brightness":      normalizeNumber,
+	"contrast":        normalizeNumber,
+	"saturation":      normalizeNumber,
+	"gamma":           normalizeNumber,
+	"blur":            normalizeNumber,
+	"overlay-opacity": normalizeNumber,
+	"txt-shadow":      normalizeNumber,
+}
+
+func normalizeInt(value string) string {
+	if i, err := strconv.Atoi(value); err == nil {
+		return strconv.Itoa(i)
+	}
+
+	return value
+}
+
+func normalizeNumber(value string) string {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return value
+}
+
+func normalizeBool(value string) string {
+	if b, err := strconv.ParseBool(value); err == nil {
+		return strconv.FormatBool(b)
+	}
+
+	return value
+}
+
+// ParseOptions parses the transformation options from the query parameters of
+// the request and validates the parameters used by the encoders, returning a
+// transform.ParamErrors listing every parameter that is invalid. When
+// opts.StrictParams is enabled, parameters that are not used by ims are also
+// reported.
+func ParseOptions(opts *ProcessOpts, r *http.Request) (*transform.Options, error) {
+	p := &transform.Parser{Values: r.URL.Query()}
+	o := transform.ParseOptionsWith(p)
+
+	// The focal point of the source image is used when the request does not
+	// provide one.
+	if focus, ok := r.Context().Value(focalPointKey{}).(*transform.FocalPoint); ok && o.Focus == nil {
+		o.Focus = focus
+	}
+
+	// The overlay image is loaded by the caller.
+	if m, ok := r.Context().Value(overlayImageKey{}).(image.Image); ok && o.Overlay != nil {
+		o.Overlay.Image = m
+	}
+
+	p.Int("quality", 1, 100)
+	p.Bool("lossless")
+	p.Enum("frame", "1")
+
+	if opts.StrictParams {
+		known := make(map[string]bool)
+		for _, param := range append(params, transform.Params...) {
+			known[param] = true
+		}
+
+		var unknown []string
+		for param := range p.Values {
+			if !known[param] {
+				unknown = append(unknown, param)
+			}
+		}
+
+		sort.Strings(unknown)
+
+		for _, param := range unknown {
+			p.Fail(param, "unknown parameter")
+		}
+	}
+
+	if len(p.Errors) > 0 {
+		return nil, p.Errors
+	}
+
+	return o, nil
+}
+
+// CanonicalQuery returns the query parameters of the request that affect the
+// processed image in a canonical form, so that equivalent requests produce the
+// same value. Only the first value of the parameters used by ims is kept, as
+// the others are ignored, and the numeric values are normalized. The signature
+// is removed, and when the output format is negotiated, it's replaced with the
+// result of the negotiation.
+func CanonicalQuery(r *http.Request) string {
+	query := r.URL.Query()
+
+	values := make(url.Values)
+	for _, key := range append(params, transform.Params...) {
+		v := query.Get(key)
+		if key == "sig" || v == "" {
+			continue
+		}
+
+		if normalize, ok := normalizers[key]; ok {
+			v = normalize(v)
+		}
+
+		values.Set(key, v)
+	}
+
+	if encoder.IsNegotiated(r) {
+		values.Del("auto")
+		values.Set("format", "auto:"+encoder.Negotiate(r))
+	}
+
+	// Encode sorts the values by key.
+	return values.Encode()
+}
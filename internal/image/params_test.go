@@ -0,0 +1,85 @@
+package image
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wyattjoh/ims/internal/image/transform"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		strict   bool
+		expected []string
+	}{
+		{"valid", "width=10&format=webp&quality=80&lossless=false&frame=1&sig=abc", true, nil},
+		{"quality", "quality=500", false, []string{"quality"}},
+		{"lossless", "lossless=maybe", false, []string{"lossless"}},
+		{"frame", "frame=2", false, []string{"frame"}},
+		{"unknown", "widht=10", false, nil},
+		{"strict unknown", "widht=10&qualty=80", true, []string{"qualty", "widht"}},
+		{"strict invalid and unknown", "blur=-3&widht=10", true, []string{"blur", "widht"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+
+			_, err := ParseOptions(&ProcessOpts{StrictParams: tt.strict}, r)
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+
+				return
+			}
+
+			var errs transform.ParamErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected ParamErrors, got %v", err)
+			}
+
+			var params []string
+			for _, e := range errs {
+				params = append(params, e.Param)
+			}
+
+			if !reflect.DeepEqual(params, tt.expected) {
+				t.Errorf("Expected errors for %v, got %v", tt.expected, params)
+			}
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"sorted", "width=10&height=20", "height=20&width=10"},
+		{"signature", "width=10&sig=abc", "width=10"},
+		{"unknown", "width=10&x=1&widht=2", "width=10"},
+		{"empty", "width=10&height=", "width=10"},
+		{"repeated", "width=10&width=20", "width=10"},
+		{"integers", "width=0100&quality=%2B80", "quality=80&width=100"},
+		{"numbers", "dpr=2.0&blur=.5&fp-x=0.50", "blur=0.5&dpr=2&fp-x=0.5"},
+		{"booleans", "lossless=1", "lossless=true"},
+		{"invalid integers", "width=1e2", "width=1e2"},
+		{"text", "txt=0100", "txt=0100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/image.jpg?"+tt.query, nil)
+
+			if actual := CanonicalQuery(r); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package provider
 import (
 	"context"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 
 	"github.com/pkg/errors"
 )
@@ -16,6 +18,17 @@ type Filesystem struct {
 
 // Provide provides a file via the virtual http.Dir filesystem.
 func (fp *Filesystem) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	obj, err := fp.ProvideObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ProvideObject provides a file via the virtual http.Dir filesystem along with
+// its modification time, size, and the content type based on its extension.
+func (fp *Filesystem) ProvideObject(ctx context.Context, filename string) (*Object, error) {
 	// Try to open the image from the virtual filesystem.
 	f, err := fp.Dir.Open(filename)
 	if err != nil {
@@ -27,5 +40,16 @@ func (fp *Filesystem) Provide(ctx context.Context, filename string) (io.ReadClos
 		return nil, errors.Wrap(err, "cannot get file from filesystem")
 	}
 
-	return f, nil
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "cannot stat file from filesystem")
+	}
+
+	return &Object{
+		ReadCloser:  f,
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(path.Ext(filename)),
+		Size:        info.Size(),
+	}, nil
 }
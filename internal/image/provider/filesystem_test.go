@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestFilesystem_Provide(t *testing.T) {
@@ -152,3 +153,40 @@ func TestFilesystem_ProvideContextCancellation(t *testing.T) {
 		reader.Close()
 	}
 }
+
+func TestFilesystem_ProvideObject(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	testFile := filepath.Join(tmpDir, "test.png")
+	if err := os.WriteFile(testFile, []byte("test content"), 0o644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Chtimes(testFile, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set the modification time: %v", err)
+	}
+
+	fs := &Filesystem{Dir: http.Dir(tmpDir)}
+
+	obj, err := fs.ProvideObject(context.Background(), "test.png")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer obj.Close()
+
+	if !obj.ModTime.Equal(modTime) {
+		t.Errorf("Expected modification time %v, got %v", modTime, obj.ModTime)
+	}
+
+	if obj.Size != int64(len("test content")) {
+		t.Errorf("Expected size %d, got %d", len("test content"), obj.Size)
+	}
+
+	if obj.ContentType != "image/png" {
+		t.Errorf("Expected content type image/png, got %s", obj.ContentType)
+	}
+
+	if obj.Version() == "" {
+		t.Errorf("Expected a version, got none")
+	}
+}
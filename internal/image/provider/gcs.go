@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"cloud.google.com/go/storage"
 	"github.com/pkg/errors"
@@ -53,6 +55,17 @@ type GCS struct {
 // specified key and then returning the response body when the request was
 // complete.
 func (gcs *GCS) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	obj, err := gcs.ProvideObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ProvideObject provides a file like Provide along with the attributes of the
+// object, where the generation is used as its ETag.
+func (gcs *GCS) ProvideObject(ctx context.Context, filename string) (*Object, error) {
 	// Get the object handlea and return a reader based on the object handle.
 	r, err := gcs.bucket.Object(filename).NewReader(ctx)
 	if err != nil {
@@ -63,5 +76,23 @@ func (gcs *GCS) Provide(ctx context.Context, filename string) (io.ReadCloser, er
 		return nil, errors.Wrap(err, "cannot get file from provider")
 	}
 
-	return r, nil
+	obj := &Object{
+		ReadCloser:   r,
+		ETag:         strconv.FormatInt(r.Attrs.Generation, 10),
+		ModTime:      r.Attrs.LastModified,
+		ContentType:  r.Attrs.ContentType,
+		Size:         r.Attrs.Size,
+		CacheControl: r.Attrs.CacheControl,
+	}
+
+	// The custom metadata is only available when the object is read with the
+	// XML or gRPC APIs.
+	if metadata := r.Metadata(); len(metadata) > 0 {
+		obj.Metadata = make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			obj.Metadata[strings.ToLower(key)] = value
+		}
+	}
+
+	return obj, nil
 }
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Object is a file provided by a Provider along with the metadata that
+// describes it.
+type Object struct {
+	io.ReadCloser
+
+	// ETag identifies the version of the file on the provider when it's known.
+	ETag string
+
+	// ModTime is the time that the file was last modified when it's known.
+	ModTime time.Time
+
+	// ContentType is the media type of the file when it's known.
+	ContentType string
+
+	// Size is the size of the file in bytes when it's known, otherwise zero.
+	Size int64
+
+	// CacheControl is the Cache-Control directives of the file when they are
+	// known.
+	CacheControl string
+
+	// Expires is the time that the file expires when it's known.
+	Expires time.Time
+
+	// Metadata is the user defined metadata of the file with lowercase keys
+	// when it's known.
+	Metadata map[string]string
+}
+
+// ObjectProvider describes a Provider that can also provide the metadata of
+// the files it provides.
+type ObjectProvider interface {
+	Provider
+	ProvideObject(ctx context.Context, filename string) (*Object, error)
+}
+
+// ProvideObject provides the file from the provider along with its metadata
+// when the provider supports it.
+func ProvideObject(ctx context.Context, p Provider, filename string) (*Object, error) {
+	if op, ok := p.(ObjectProvider); ok {
+		return op.ProvideObject(ctx, filename)
+	}
+
+	rc, err := p.Provide(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{ReadCloser: rc}, nil
+}
+
+// Version returns a value that identifies the version of the file, which is
+// the ETag when it's known, otherwise the modification time. An empty string
+// is returned when neither is known.
+func (o *Object) Version() string {
+	if o.ETag != "" {
+		return o.ETag
+	}
+
+	if !o.ModTime.IsZero() {
+		return o.ModTime.UTC().Format(time.RFC3339Nano)
+	}
+
+	return ""
+}
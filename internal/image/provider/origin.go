@@ -26,6 +26,17 @@ type Origin struct {
 // specified filename and then returning the response body when the request was
 // complete.
 func (op *Origin) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	obj, err := op.ProvideObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ProvideObject provides a file like Provide along with the metadata from the
+// response headers.
+func (op *Origin) ProvideObject(ctx context.Context, filename string) (*Object, error) {
 	// Parse the incomming url.
 	filenameURL, err := url.Parse(filename)
 	if err != nil {
@@ -27,6 +27,17 @@ type Proxy struct {
 // Provide provides a file by making a request to the server with the specified
 // filename and then returning the response body when the request was complete.
 func (pp *Proxy) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	obj, err := pp.ProvideObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ProvideObject provides a file like Provide along with the metadata from the
+// response headers.
+func (pp *Proxy) ProvideObject(ctx context.Context, filename string) (*Object, error) {
 	// Parse the incomming url.
 	fileURL, err := url.Parse(filename)
 	if err != nil {
@@ -37,7 +48,7 @@ func (pp *Proxy) Provide(ctx context.Context, filename string) (io.ReadCloser, e
 }
 
 // Handle implements the reusable logic behind the Proxy Provider.
-func (pp *Proxy) Handle(ctx context.Context, fileURL fmt.Stringer) (io.ReadCloser, error) {
+func (pp *Proxy) Handle(ctx context.Context, fileURL fmt.Stringer) (*Object, error) {
 	// Perform the GET to the origin server. This takes the url passed in as the
 	// origin and resolves a relative reference with the filename passed in. It
 	// will not attach any query params sent on the original request.
@@ -58,13 +69,37 @@ func (pp *Proxy) Handle(ctx context.Context, fileURL fmt.Stringer) (io.ReadClose
 
 	// If the code was explicitly a 404, return in kind.
 	if res.StatusCode == 404 {
+		res.Body.Close()
 		return nil, ErrNotFound
 	}
 
 	// If the code wasn't a 200, then return that there was a bad gateway.
 	if res.StatusCode != 200 {
+		res.Body.Close()
 		return nil, ErrBadGateway
 	}
 
-	return res.Body, nil
+	obj := &Object{
+		ReadCloser:   res.Body,
+		ETag:         res.Header.Get("ETag"),
+		ContentType:  res.Header.Get("Content-Type"),
+		CacheControl: res.Header.Get("Cache-Control"),
+	}
+
+	// The content length is -1 when it's unknown.
+	if res.ContentLength > 0 {
+		obj.Size = res.ContentLength
+	}
+
+	// The modification and expiry times are optional, so ignore them if they're
+	// invalid.
+	if modTime, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = modTime
+	}
+
+	if expires, err := http.ParseTime(res.Header.Get("Expires")); err == nil {
+		obj.Expires = expires
+	}
+
+	return obj, nil
 }
@@ -348,3 +348,37 @@ func TestProxy_HandleRealServer(t *testing.T) {
 		})
 	}
 }
+
+func TestProxy_ProvideObject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Thu, 02 Jan 2020 03:04:05 GMT")
+		w.Write([]byte("image content"))
+	}))
+	defer server.Close()
+
+	proxy := NewProxy(nil)
+
+	obj, err := proxy.ProvideObject(context.Background(), server.URL+"/test.jpg")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer obj.Close()
+
+	if obj.ETag != `"abc"` {
+		t.Errorf("Expected ETag %q, got %q", `"abc"`, obj.ETag)
+	}
+
+	if obj.ContentType != "image/jpeg" {
+		t.Errorf("Expected content type image/jpeg, got %s", obj.ContentType)
+	}
+
+	if obj.Size != int64(len("image content")) {
+		t.Errorf("Expected size %d, got %d", len("image content"), obj.Size)
+	}
+
+	if obj.ModTime.IsZero() || obj.ModTime.Year() != 2020 {
+		t.Errorf("Expected the modification time to be parsed, got %v", obj.ModTime)
+	}
+}
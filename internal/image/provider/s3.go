@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/minio/minio-go"
 	"github.com/pkg/errors"
@@ -43,6 +44,17 @@ type S3 struct {
 
 // Provide loads the file from the S3 client.
 func (s *S3) Provide(ctx context.Context, filename string) (io.ReadCloser, error) {
+	obj, err := s.ProvideObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ProvideObject loads the file from the S3 client along with the metadata of
+// the object.
+func (s *S3) ProvideObject(ctx context.Context, filename string) (*Object, error) {
 	// Get the reader from the minio client.
 	r, err := s.client.GetObject(s.bucket, filename, minio.GetObjectOptions{})
 	if err != nil {
@@ -70,8 +82,40 @@ func (s *S3) Provide(ctx context.Context, filename string) (io.ReadCloser, error
 		return nil, errors.Wrap(err, "could not copy into the buffer")
 	}
 
+	// The object information was already retrieved when the object was read,
+	// so this will not make another request.
+	info, err := r.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the object information")
+	}
+
 	// The bytes buffer isn't a closer by nature, just wrap it with a no-op closer
 	// to satisfy the interface, it will be managed by the GC to clean up
 	// afterwards.
-	return io.NopCloser(buf), nil
+	obj := &Object{
+		ReadCloser:   io.NopCloser(buf),
+		ETag:         info.ETag,
+		ModTime:      info.LastModified,
+		ContentType:  info.ContentType,
+		Size:         info.Size,
+		CacheControl: info.Metadata.Get("Cache-Control"),
+	}
+
+	// The expiry time is optional, so ignore it if it's invalid.
+	if expires, err := http.ParseTime(info.Metadata.Get("Expires")); err == nil {
+		obj.Expires = expires
+	}
+
+	// The user defined metadata is provided as headers with a prefix.
+	for key, values := range info.Metadata {
+		if name, ok := strings.CutPrefix(strings.ToLower(key), "x-amz-meta-"); ok && len(values) > 0 {
+			if obj.Metadata == nil {
+				obj.Metadata = make(map[string]string)
+			}
+
+			obj.Metadata[name] = values[0]
+		}
+	}
+
+	return obj, nil
 }
@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Sharpen is the unsharp mask applied to the image.
+type Sharpen struct {
+	// Amount is how much the difference from the blurred image is amplified,
+	// from 0 to 10.
+	Amount float64
+
+	// Radius is the sigma of the Gaussian blur that the image is compared to,
+	// from 0.5 to 1000.
+	Radius float64
+
+	// Threshold is the minimum difference from the blurred image, from 0 to
+	// 255, that a pixel must have to be sharpened.
+	Threshold int
+}
+
+// parseSharpen parses the sharpen parameter in the form
+// `a{amount},r{radius},t{threshold}`, where the amount is required and the
+// radius and threshold default to 1 and 0.
+func parseSharpen(value string) (*Sharpen, bool) {
+	s := &Sharpen{Radius: 1}
+	hasAmount := false
+
+	for _, part := range strings.Split(value, ",") {
+		if part == "" {
+			return nil, false
+		}
+
+		n, err := strconv.ParseFloat(part[1:], 64)
+		if err != nil || math.IsNaN(n) {
+			return nil, false
+		}
+
+		switch part[0] {
+		case 'a':
+			if n < 0 || n > 10 {
+				return nil, false
+			}
+			s.Amount, hasAmount = n, true
+		case 'r':
+			if n < 0.5 || n > 1000 {
+				return nil, false
+			}
+			s.Radius = n
+		case 't':
+			if n < 0 || n > 255 || n != math.Trunc(n) {
+				return nil, false
+			}
+			s.Threshold = int(n)
+		default:
+			return nil, false
+		}
+	}
+
+	return s, hasAmount
+}
+
+// SharpenImage sharpens the image with an unsharp mask, which amplifies the
+// difference of each channel from a blurred copy of the image when it's more
+// than the threshold.
+func SharpenImage(m image.Image, s *Sharpen) image.Image {
+	dst := imaging.Clone(m)
+	blurred := imaging.Blur(dst, s.Radius)
+
+	for i := 0; i < len(dst.Pix); i += 4 {
+		for c := i; c < i+3; c++ {
+			diff := float64(dst.Pix[c]) - float64(blurred.Pix[c])
+			if math.Abs(diff) > float64(s.Threshold) {
+				dst.Pix[c] = uint8(math.Max(0, math.Min(255, math.Round(float64(dst.Pix[c])+s.Amount*diff))))
+			}
+		}
+	}
+
+	return dst
+}
+
+// =============================================================================
+
+// Adjustments are the color and tone adjustments applied to the image, where
+// the zero value does not change it.
+type Adjustments struct {
+	// Brightness, Contrast and Saturation are the percentages from -100 to 100
+	// that they are changed by.
+	Brightness, Contrast, Saturation float64
+
+	// Gamma is the gamma correction from 0.1 to 10, where 1 and 0 do not
+	// change the image.
+	Gamma float64
+
+	// Sharpen is the unsharp mask applied to the image, which is nil when not
+	// sharpening.
+	Sharpen *Sharpen
+}
+
+// AdjustImage applies the adjustments to the image in the order of the
+// brightness, contrast, saturation, gamma and then sharpen.
+func AdjustImage(m image.Image, a *Adjustments) image.Image {
+	if a.Brightness != 0 {
+		m = imaging.AdjustBrightness(m, a.Brightness)
+	}
+
+	if a.Contrast != 0 {
+		m = imaging.AdjustContrast(m, a.Contrast)
+	}
+
+	if a.Saturation != 0 {
+		m = imaging.AdjustSaturation(m, a.Saturation)
+	}
+
+	if a.Gamma != 0 && a.Gamma != 1 {
+		m = imaging.AdjustGamma(m, a.Gamma)
+	}
+
+	if a.Sharpen != nil && a.Sharpen.Amount > 0 {
+		m = SharpenImage(m, a.Sharpen)
+	}
+
+	return m
+}
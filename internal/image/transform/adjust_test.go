@@ -0,0 +1,77 @@
+package transform
+
+import (
+	"image"
+	"testing"
+)
+
+func TestAdjustImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		adjustments Adjustments
+	}{
+		{"brightness", Adjustments{Brightness: 30}},
+		{"contrast", Adjustments{Contrast: -40}},
+		{"saturation", Adjustments{Saturation: -100}},
+		{"gamma", Adjustments{Gamma: 2.2}},
+		{"sharpen", Adjustments{Sharpen: &Sharpen{Amount: 3, Radius: 2}}},
+		{"sharpen-threshold", Adjustments{Sharpen: &Sharpen{Amount: 3, Radius: 2, Threshold: 40}}},
+		{"chain", Adjustments{Brightness: -10, Contrast: 25, Saturation: 50, Gamma: 0.8, Sharpen: &Sharpen{Amount: 1, Radius: 1}}},
+	}
+
+	m := scene(64, 48, image.Rect(16, 8, 48, 40))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden(t, "adjust-"+tt.name, AdjustImage(m, &tt.adjustments))
+		})
+	}
+}
+
+func TestAdjustImageUnchanged(t *testing.T) {
+	m := scene(16, 16, image.Rect(4, 4, 12, 12))
+
+	for _, a := range []Adjustments{{}, {Gamma: 1}, {Sharpen: &Sharpen{Radius: 1}}} {
+		if out := AdjustImage(m, &a); out != image.Image(m) {
+			t.Errorf("Expected the image to be unchanged by %+v", a)
+		}
+	}
+}
+
+func TestParseSharpen(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected *Sharpen
+	}{
+		{"a5,r2,t10", &Sharpen{Amount: 5, Radius: 2, Threshold: 10}},
+		{"t10,a0.5", &Sharpen{Amount: 0.5, Radius: 1, Threshold: 10}},
+		{"r2", nil},
+		{"a5,", nil},
+		{"a", nil},
+		{"aNaN", nil},
+		{"a5,r0.1", nil},
+		{"a5,t1.5", nil},
+		{"a5,t256", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			s, ok := parseSharpen(tt.value)
+			if tt.expected == nil {
+				if ok {
+					t.Fatalf("Expected %q to be invalid, got %+v", tt.value, s)
+				}
+
+				return
+			}
+
+			if !ok {
+				t.Fatalf("Expected %q to be valid", tt.value)
+			}
+
+			if *s != *tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package transform
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+)
+
+// CanvasBounds returns the bounds of the canvas that the frames of the
+// animation are rendered onto, which is the logical screen of the GIF, or the
+// union of the frames when it's empty.
+func CanvasBounds(g *gif.GIF) image.Rectangle {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+
+	return bounds
+}
+
+// Coalesce renders each frame of the animation onto the full canvas, applying
+// the disposal method of the previous frames, so that every frame can be
+// transformed on its own. It also reports if any of the rendered frames contain
+// transparent pixels.
+func Coalesce(g *gif.GIF) ([]*image.NRGBA, bool) {
+	canvas := image.NewNRGBA(CanvasBounds(g))
+	frames := make([]*image.NRGBA, 0, len(g.Image))
+	transparent := false
+
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		// Keep a copy of the canvas to restore if this frame should be disposed
+		// to the previous state.
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		rendered := cloneNRGBA(canvas)
+		if !rendered.Opaque() {
+			transparent = true
+		}
+		frames = append(frames, rendered)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, transparent
+}
+
+// cloneNRGBA returns a copy of the image.
+func cloneNRGBA(m *image.NRGBA) *image.NRGBA {
+	clone := image.NewNRGBA(m.Bounds())
+	copy(clone.Pix, m.Pix)
+
+	return clone
+}
+
+// fixedWindows returns a copy of the options where the smart crops are
+// positioned by their windows within the frame, so that every frame of an
+// animation is cropped to the same windows rather than ones that follow the
+// content of each frame. The crop is positioned at its window, and the window
+// of the crop fit is kept in frame with a focal point at its center.
+func fixedWindows(m image.Image, o *Options) *Options {
+	if o.Focus != nil {
+		return o
+	}
+
+	fixed := *o
+	bounds := m.Bounds()
+
+	rect := bounds
+	if o.Crop != nil {
+		rect = cropRect(m, o.Crop, nil)
+
+		if o.Crop.Mode != "" && !o.Crop.Positioned {
+			fixed.Crop = &Crop{
+				Width:      Length{Value: float64(rect.Dx())},
+				Height:     Length{Value: float64(rect.Dy())},
+				X:          &Length{Value: float64(rect.Min.X - bounds.Min.X)},
+				Y:          &Length{Value: float64(rect.Min.Y - bounds.Min.Y)},
+				Positioned: true,
+			}
+		}
+	}
+
+	if o.Fit == "crop" && o.Width > 0 && o.Height > 0 && o.CropMode != "" && o.CropMode != CropModeCenter {
+		size := fillSize(rect.Size(), o.Width, o.Height)
+		resized := imaging.Resize(imaging.Crop(m, rect), size.X, size.Y, o.Filter)
+		window := SmartRect(resized, o.Width, o.Height, o.CropMode)
+
+		// The focal point is relative to the frame before it's cropped.
+		x := (float64(window.Min.X) + float64(window.Dx())/2) / float64(size.X)
+		y := (float64(window.Min.Y) + float64(window.Dy())/2) / float64(size.Y)
+
+		fixed.Focus = &FocalPoint{
+			X: (float64(rect.Min.X-bounds.Min.X) + x*float64(rect.Dx())) / float64(bounds.Dx()),
+			Y: (float64(rect.Min.Y-bounds.Min.Y) + y*float64(rect.Dy())) / float64(bounds.Dy()),
+		}
+	}
+
+	return &fixed
+}
+
+// Animation applies the transformations to every frame of the animation and
+// returns a new animation with the original delays and loop count. As the
+// frames are coalesced before being transformed, the original disposal methods
+// are only kept when the animation is fully opaque, otherwise each frame is
+// disposed to the background so transparent areas are not drawn over the
+// previous frame. Smart crops are positioned on the first frame and used for
+// every frame, so the content doesn't jump around between frames.
+func Animation(g *gif.GIF, o *Options) (*gif.GIF, error) {
+	frames, transparent := Coalesce(g)
+	if len(frames) > 0 {
+		o = fixedWindows(frames[0], o)
+	}
+
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(frames)),
+		Delay:           make([]int, len(frames)),
+		Disposal:        make([]byte, len(frames)),
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+
+	for i, frame := range frames {
+		tm, err := Image(frame, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not transform frame %d", i)
+		}
+
+		// Each frame has its own palette, as the transformations may have
+		// changed the colors from the ones in the original palette.
+		out.Image[i] = Quantize(tm)
+
+		if i < len(g.Delay) {
+			out.Delay[i] = g.Delay[i]
+		}
+
+		switch {
+		case transparent:
+			out.Disposal[i] = gif.DisposalBackground
+		case i < len(g.Disposal):
+			out.Disposal[i] = g.Disposal[i]
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"net/url"
+	"testing"
+)
+
+func TestAnimationColors(t *testing.T) {
+	// The frames are red and then blue, so their transformed colors are not in
+	// the original palette.
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	p := color.Palette{red, blue}
+	g := &gif.GIF{Config: image.Config{Width: 40, Height: 20, ColorModel: p}}
+	for i := range p {
+		frame := image.NewPaletted(image.Rect(0, 0, 40, 20), p)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(i)
+		}
+
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"grayscale", "filter=grayscale"},
+		{"sepia", "filter=sepia"},
+		{"invert", "filter=invert"},
+		{"duotone", "duotone=203040,f0e0a0"},
+		{"tint", "tint=00ff0080"},
+		{"overlay", "overlay=logo.png&overlay-pos=center"},
+		{"text", "txt=ims&txt-size=12&txt-color=ff0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if o.Overlay != nil {
+				o.Overlay.Image = logo(12, 8)
+			}
+
+			out, err := Animation(g, o)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			frames, _ := Coalesce(g)
+			for i, frame := range frames {
+				expected, err := Image(frame, o)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+
+				// The frames have few enough colors to be kept exactly.
+				for y := 0; y < 20; y++ {
+					for x := 0; x < 40; x++ {
+						e := color.NRGBAModel.Convert(expected.At(x, y))
+						if c := color.NRGBAModel.Convert(out.Image[i].At(x, y)); c != e {
+							t.Fatalf("Expected frame %d to be %v at (%d, %d), got %v", i, e, x, y, c)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	// A gradient with more colors than fit in the palette, with a transparent
+	// corner.
+	m := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255}
+			if x < 8 && y < 8 {
+				c = color.NRGBA{}
+			}
+
+			m.SetNRGBA(x, y, c)
+		}
+	}
+
+	q := Quantize(m)
+
+	if len(q.Palette) != 256 {
+		t.Fatalf("Expected 256 colors, got %d", len(q.Palette))
+	}
+
+	if c := color.NRGBAModel.Convert(q.At(0, 0)); c != (color.NRGBA{}) {
+		t.Errorf("Expected the corner to be transparent, got %v", c)
+	}
+
+	for y := 8; y < 64; y++ {
+		for x := 8; x < 64; x++ {
+			c := q.At(x, y).(color.NRGBA)
+			e := m.NRGBAAt(x, y)
+			if abs(int(c.R)-int(e.R)) > 16 || abs(int(c.G)-int(e.G)) > 16 || c.B != e.B || c.A != 255 {
+				t.Fatalf("Expected %v at (%d, %d), got %v", e, x, y, c)
+			}
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,188 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseColor parses a color in the hex form `{rgb}`, `{rgba}`, `{rrggbb}` or
+// `{rrggbbaa}`, or in the decimal form `{r},{g},{b}` or `{r},{g},{b},{a}` where
+// the alpha is from 0 to 1.
+func ParseColor(value string) (color.Color, bool) {
+	if parts := strings.Split(value, ","); len(parts) == 3 || len(parts) == 4 {
+		c := color.NRGBA{A: 255}
+		for i, channel := range []*uint8{&c.R, &c.G, &c.B} {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil || n < 0 || n > 255 {
+				return nil, false
+			}
+
+			*channel = uint8(n)
+		}
+
+		if len(parts) == 4 {
+			a, err := strconv.ParseFloat(parts[3], 64)
+			if err != nil || a < 0 || a > 1 {
+				return nil, false
+			}
+
+			c.A = uint8(math.Round(a * 255))
+		}
+
+		return c, true
+	}
+
+	value = strings.TrimPrefix(value, "#")
+
+	// Expand the short forms so that every channel has two digits.
+	if len(value) == 3 || len(value) == 4 {
+		var expanded strings.Builder
+		for _, r := range value {
+			expanded.WriteRune(r)
+			expanded.WriteRune(r)
+		}
+		value = expanded.String()
+	}
+
+	if len(value) == 6 {
+		value += "ff"
+	}
+
+	if len(value) != 8 {
+		return nil, false
+	}
+
+	n, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return nil, false
+	}
+
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, true
+}
+
+// =============================================================================
+
+// Padding is the space added around each side of the image.
+type Padding struct {
+	Top, Right, Bottom, Left Length
+}
+
+// String returns the padding in the form {top},{right},{bottom},{left}.
+func (p *Padding) String() string {
+	return strings.Join([]string{p.Top.String(), p.Right.String(), p.Bottom.String(), p.Left.String()}, ",")
+}
+
+// Size returns the size of the image with the size once it's padded.
+func (p *Padding) Size(size image.Point) image.Point {
+	return image.Pt(
+		size.X+p.Left.Pixels(size.X)+p.Right.Pixels(size.X),
+		size.Y+p.Top.Pixels(size.Y)+p.Bottom.Pixels(size.Y),
+	)
+}
+
+// parsePadding parses the padding in the same form as the CSS padding
+// shorthand, where one value is used for every side, two values are used for
+// the top and bottom then the left and right, three values are used for the
+// top, the left and right then the bottom, and four values are used for the
+// top, right, bottom and left. The values are in pixels of at most
+// MaxDimension or percentages of the image (`10p`).
+func parsePadding(value string) (*Padding, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) > 4 {
+		return nil, false
+	}
+
+	lengths := make([]Length, len(parts))
+	for i, part := range parts {
+		l, ok := parseLength(part, false)
+		if !ok || (!l.Percent && l.Value > MaxDimension) {
+			return nil, false
+		}
+
+		lengths[i] = l
+	}
+
+	switch len(lengths) {
+	case 1:
+		return &Padding{lengths[0], lengths[0], lengths[0], lengths[0]}, true
+	case 2:
+		return &Padding{lengths[0], lengths[1], lengths[0], lengths[1]}, true
+	case 3:
+		return &Padding{lengths[0], lengths[1], lengths[2], lengths[1]}, true
+	default:
+		return &Padding{lengths[0], lengths[1], lengths[2], lengths[3]}, true
+	}
+}
+
+// background returns a new image of the size filled with the background color,
+// which is transparent when it's nil.
+func background(width, height int, bg color.Color) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if bg != nil {
+		draw.Draw(m, m.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+
+	return m
+}
+
+// PadImage adds the padding around the image filled with the background color,
+// which is transparent when it's nil.
+func PadImage(m image.Image, p *Padding, bg color.Color) image.Image {
+	size := m.Bounds().Size()
+	padded := p.Size(size)
+
+	top, left := p.Top.Pixels(size.Y), p.Left.Pixels(size.X)
+
+	dst := background(padded.X, padded.Y, bg)
+	draw.Draw(dst, image.Rect(left, top, left+size.X, top+size.Y), m, m.Bounds().Min, draw.Over)
+
+	return dst
+}
+
+// CanvasImage places the image on a canvas filled with the background color,
+// which is transparent when it's nil. The canvas has the dimensions of the
+// region, or is the smallest canvas with its aspect ratio that contains the
+// image, and the image is positioned on it like the region is positioned when
+// cropping. Canvases smaller than the image crop it.
+func CanvasImage(m image.Image, c *Crop, bg color.Color) image.Image {
+	size := m.Bounds().Size()
+
+	canvas := canvasSize(size, c)
+	width, height := canvas.X, canvas.Y
+
+	x := int(math.Round(float64(width-size.X) * c.OffsetX))
+	if c.X != nil {
+		x = c.X.Pixels(width)
+	}
+
+	y := int(math.Round(float64(height-size.Y) * c.OffsetY))
+	if c.Y != nil {
+		y = c.Y.Pixels(height)
+	}
+
+	dst := background(width, height, bg)
+	draw.Draw(dst, image.Rect(x, y, x+size.X, y+size.Y), m, m.Bounds().Min, draw.Over)
+
+	return dst
+}
+
+// canvasSize returns the size of the canvas that the image with the size is
+// placed on.
+func canvasSize(size image.Point, c *Crop) image.Point {
+	var width, height int
+	if c.Ratio > 0 {
+		if float64(size.X)/float64(size.Y) > c.Ratio {
+			width, height = size.X, int(math.Round(float64(size.X)/c.Ratio))
+		} else {
+			width, height = int(math.Round(float64(size.Y)*c.Ratio)), size.Y
+		}
+	} else {
+		width, height = c.Width.Pixels(size.X), c.Height.Pixels(size.Y)
+	}
+
+	return image.Pt(max(width, 1), max(height, 1))
+}
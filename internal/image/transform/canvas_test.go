@@ -0,0 +1,159 @@
+package transform
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected color.Color
+	}{
+		{"f00", color.NRGBA{255, 0, 0, 255}},
+		{"#f008", color.NRGBA{255, 0, 0, 136}},
+		{"00ff00", color.NRGBA{0, 255, 0, 255}},
+		{"0000ff80", color.NRGBA{0, 0, 255, 128}},
+		{"255,128,0", color.NRGBA{255, 128, 0, 255}},
+		{"255,128,0,0.5", color.NRGBA{255, 128, 0, 128}},
+		{"", nil},
+		{"ff", nil},
+		{"ggg", nil},
+		{"256,0,0", nil},
+		{"0,0,0,2", nil},
+		{"0,0", nil},
+	}
+
+	for _, tt := range tests {
+		c, ok := ParseColor(tt.value)
+		if ok != (tt.expected != nil) || c != tt.expected {
+			t.Errorf("Expected %q to parse as %v, got %v", tt.value, tt.expected, c)
+		}
+	}
+}
+
+func TestParsePadding(t *testing.T) {
+	px := func(n float64) Length { return Length{Value: n} }
+
+	tests := []struct {
+		value    string
+		expected *Padding
+	}{
+		{"10", &Padding{px(10), px(10), px(10), px(10)}},
+		{"10,20", &Padding{px(10), px(20), px(10), px(20)}},
+		{"10,20,30", &Padding{px(10), px(20), px(30), px(20)}},
+		{"10,20,30,40", &Padding{px(10), px(20), px(30), px(40)}},
+		{"0,10p", &Padding{px(0), Length{10, true}, px(0), Length{10, true}}},
+		{"10,20,30,40,50", nil},
+		{"-10", nil},
+		{"abc", nil},
+	}
+
+	for _, tt := range tests {
+		p, _ := parsePadding(tt.value)
+		if (p == nil) != (tt.expected == nil) || (p != nil && *p != *tt.expected) {
+			t.Errorf("Expected %q to parse as %+v, got %+v", tt.value, tt.expected, p)
+		}
+	}
+}
+
+// solid returns an opaque image of the size filled with a color.
+func solid(width, height int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range m.Pix {
+		m.Pix[i] = 255
+	}
+
+	return m
+}
+
+func TestImagePadAndCanvas(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		size     image.Point
+		image    image.Rectangle
+		expected color.Color
+	}{
+		{"pad", "pad=10,20", image.Pt(140, 70), image.Rect(20, 10, 120, 60), color.NRGBA{}},
+		{"pad percentages", "pad=10p&bg-color=f00", image.Pt(120, 60), image.Rect(10, 5, 110, 55), color.NRGBA{255, 0, 0, 255}},
+		{"canvas", "canvas=200,100&bg-color=00f", image.Pt(200, 100), image.Rect(50, 25, 150, 75), color.NRGBA{0, 0, 255, 255}},
+		{"canvas positioned", "canvas=200,100,x0,y10", image.Pt(200, 100), image.Rect(0, 10, 100, 60), color.NRGBA{}},
+		{"canvas anchored", "canvas=200,100,bottom-right", image.Pt(200, 100), image.Rect(100, 50, 200, 100), color.NRGBA{}},
+		{"canvas aspect ratio", "canvas=1:1", image.Pt(100, 100), image.Rect(0, 25, 100, 75), color.NRGBA{}},
+		{"canvas smaller than the image", "canvas=50,50", image.Pt(50, 50), image.Rect(0, 0, 50, 50), nil},
+		{"letterbox", "width=50&height=50&fit=bounds&canvas=50,50&bg-color=000", image.Pt(50, 50), image.Rect(0, 13, 50, 38), color.NRGBA{0, 0, 0, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			m, err := Image(solid(100, 50), o)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if size := m.Bounds().Size(); size != tt.size {
+				t.Fatalf("Expected the size %v, got %v", tt.size, size)
+			}
+
+			if c := color.NRGBAModel.Convert(m.At(tt.image.Min.X, tt.image.Min.Y)); c != (color.NRGBA{255, 255, 255, 255}) {
+				t.Errorf("Expected the image at %v, got %v", tt.image.Min, c)
+			}
+
+			if c := color.NRGBAModel.Convert(m.At(tt.image.Max.X-1, tt.image.Max.Y-1)); c != (color.NRGBA{255, 255, 255, 255}) {
+				t.Errorf("Expected the image at %v, got %v", tt.image.Max, c)
+			}
+
+			if tt.expected != nil {
+				if c := color.NRGBAModel.Convert(m.At(0, 0)); c != tt.expected {
+					t.Errorf("Expected the background %v, got %v", tt.expected, c)
+				}
+			}
+		})
+	}
+}
+
+func TestImagePadAndCanvasTooLarge(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		param string
+		value string
+	}{
+		{"pad", "pad=8100", "pad", "8100,8100,8100,8100"},
+		{"pad percentages", "width=5000&enable=upscale&pad=0,100p", "pad", "0,100p,0,100p"},
+		{"canvas aspect ratio", "canvas=1:8000", "canvas", "0.000125:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			_, err = Image(solid(100, 50), o)
+
+			var errs ParamErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("Expected ParamErrors, got %v", err)
+			}
+
+			if errs[0].Param != tt.param || errs[0].Value != tt.value {
+				t.Errorf("Expected the error for %s=%s, got %+v", tt.param, tt.value, errs[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package transform
+
+import (
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Length is a dimension or position that is either in pixels or a percentage
+// of the size of the image.
+type Length struct {
+	Value   float64
+	Percent bool
+}
+
+// parseLength parses a length in the form `{n}` for pixels or `{n}p` for a
+// percentage of at most 100, which must be greater than zero when positive.
+func parseLength(value string, positive bool) (Length, bool) {
+	l := Length{}
+	if strings.HasSuffix(value, "p") {
+		l.Percent = true
+		value = strings.TrimSuffix(value, "p")
+	}
+
+	var err error
+	if l.Percent {
+		l.Value, err = strconv.ParseFloat(value, 64)
+	} else {
+		var i int
+		i, err = strconv.Atoi(value)
+		l.Value = float64(i)
+	}
+
+	if err != nil || l.Value < 0 || (positive && l.Value == 0) || (l.Percent && l.Value > 100) {
+		return Length{}, false
+	}
+
+	return l, true
+}
+
+// String returns the length in the form `{n}` for pixels or `{n}p` for a
+// percentage.
+func (l Length) String() string {
+	s := strconv.FormatFloat(l.Value, 'f', -1, 64)
+	if l.Percent {
+		s += "p"
+	}
+
+	return s
+}
+
+// Pixels returns the length in pixels relative to the size of the image.
+func (l Length) Pixels(size int) int {
+	if l.Percent {
+		return int(math.Round(float64(size) * l.Value / 100))
+	}
+
+	return int(l.Value)
+}
+
+// =============================================================================
+
+// anchors are the named positions of the crop region, as the offsets within
+// the space that remains around it.
+var anchors = map[string][2]float64{
+	"top-left":     {0, 0},
+	"top":          {0.5, 0},
+	"top-right":    {1, 0},
+	"left":         {0, 0.5},
+	"center":       {0.5, 0.5},
+	"right":        {1, 0.5},
+	"bottom-left":  {0, 1},
+	"bottom":       {0.5, 1},
+	"bottom-right": {1, 1},
+}
+
+// Crop is the region of the image to crop to.
+type Crop struct {
+	// Width and Height are the dimensions of the region, which are ignored
+	// when cropping to a Ratio.
+	Width, Height Length
+
+	// Ratio is the aspect ratio (width / height) of the largest region that
+	// will be cropped to, which is zero when cropping to the dimensions.
+	Ratio float64
+
+	// X and Y are the position of the top left corner of the region, which are
+	// nil when the region is positioned by the offsets.
+	X, Y *Length
+
+	// OffsetX and OffsetY position the region within the space that remains
+	// around it, from 0 (left or top) to 1 (right or bottom).
+	OffsetX, OffsetY float64
+
+	// Positioned is true when the region was positioned with a position, an
+	// offset or an anchor.
+	Positioned bool
+
+	// Mode is the crop mode used to position the region based on the content
+	// of the image, which is empty when it's positioned by the other fields.
+	Mode string
+}
+
+// String returns the region in the form parsed by parseCrop, where an aspect
+// ratio is in the form {ratio}:1 and named anchors are offsets.
+func (c *Crop) String() string {
+	parts := []string{c.Width.String(), c.Height.String()}
+	if c.Ratio > 0 {
+		parts = []string{strconv.FormatFloat(c.Ratio, 'f', -1, 64) + ":1"}
+	}
+
+	if c.X != nil {
+		parts = append(parts, "x"+c.X.String())
+	} else if c.OffsetX != 0.5 {
+		parts = append(parts, "offset-x"+strconv.FormatFloat(c.OffsetX*100, 'f', -1, 64))
+	}
+
+	if c.Y != nil {
+		parts = append(parts, "y"+c.Y.String())
+	} else if c.OffsetY != 0.5 {
+		parts = append(parts, "offset-y"+strconv.FormatFloat(c.OffsetY*100, 'f', -1, 64))
+	}
+
+	if c.Mode != "" {
+		parts = append(parts, "smart")
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// parseCrop parses the crop parameter in the form:
+//
+//	{width},{height}[,{modifier}...]
+//	{width}:{height}[,{modifier}...]
+//	smart
+//
+// Where the dimensions are in pixels or percentages of the image (`50p`), or
+// an aspect ratio, and the modifiers are the position of the region in pixels
+// or percentages (`x{x}`, `y{y}`), the offset of the region as a percentage of
+// the remaining space (`offset-x{x}`, `offset-y{y}`), or a named anchor (`top`,
+// `bottom-left`, etc.), or `smart` to position the region on the content of
+// the image. The region is centered when it's not positioned. When it's only
+// `smart`, the dimensions are left empty to be provided by the caller. When it
+// can't be parsed, a message describing the problem is returned.
+func parseCrop(value string) (*Crop, string) {
+	c := &Crop{OffsetX: 0.5, OffsetY: 0.5}
+
+	if value == "smart" {
+		c.Mode = CropModeEntropy
+		return c, ""
+	}
+
+	parts := strings.Split(value, ",")
+	if width, height, ok := strings.Cut(parts[0], ":"); ok {
+		w, wErr := strconv.ParseFloat(width, 64)
+		h, hErr := strconv.ParseFloat(height, 64)
+		if wErr != nil || hErr != nil || w <= 0 || h <= 0 || math.IsInf(w/h, 0) {
+			return nil, "must have an aspect ratio in the form {width}:{height} with positive numbers"
+		}
+
+		c.Ratio = w / h
+		parts = parts[1:]
+	} else {
+		if len(parts) < 2 {
+			return nil, "must be in the form {width},{height} or {width}:{height}"
+		}
+
+		var wOk, hOk bool
+		c.Width, wOk = parseLength(parts[0], true)
+		c.Height, hOk = parseLength(parts[1], true)
+		if !wOk || !hOk {
+			return nil, "must have dimensions that are positive integers or percentages in the form {n}p"
+		}
+
+		parts = parts[2:]
+	}
+
+	// Each axis can only be positioned once.
+	var positionedX, positionedY bool
+	position := func(x, y bool) bool {
+		if (x && positionedX) || (y && positionedY) {
+			return false
+		}
+
+		positionedX, positionedY = positionedX || x, positionedY || y
+
+		return true
+	}
+
+	for _, modifier := range parts {
+		switch {
+		case strings.HasPrefix(modifier, "offset-x"), strings.HasPrefix(modifier, "offset-y"):
+			offset, err := strconv.ParseFloat(modifier[len("offset-x"):], 64)
+			if err != nil || offset < 0 || offset > 100 {
+				return nil, "must have offsets that are percentages between 0 and 100"
+			}
+
+			if modifier[len("offset-")] == 'x' {
+				if !position(true, false) {
+					return nil, "can't position the x axis more than once"
+				}
+				c.OffsetX = offset / 100
+			} else {
+				if !position(false, true) {
+					return nil, "can't position the y axis more than once"
+				}
+				c.OffsetY = offset / 100
+			}
+
+		case strings.HasPrefix(modifier, "x"), strings.HasPrefix(modifier, "y"):
+			l, ok := parseLength(modifier[1:], false)
+			if !ok {
+				return nil, "must have positions that are integers or percentages in the form {n}p"
+			}
+
+			if modifier[0] == 'x' {
+				if !position(true, false) {
+					return nil, "can't position the x axis more than once"
+				}
+				c.X = &l
+			} else {
+				if !position(false, true) {
+					return nil, "can't position the y axis more than once"
+				}
+				c.Y = &l
+			}
+
+		case modifier == "smart":
+			c.Mode = CropModeEntropy
+
+		default:
+			anchor, ok := anchors[modifier]
+			if !ok {
+				return nil, "has an unknown modifier " + strconv.Quote(modifier)
+			}
+
+			if !position(true, true) {
+				return nil, "can't combine an anchor with other positions"
+			}
+
+			c.OffsetX, c.OffsetY = anchor[0], anchor[1]
+		}
+	}
+
+	c.Positioned = positionedX || positionedY
+	if c.Positioned && c.Mode != "" {
+		return nil, "can't combine smart with other positions"
+	}
+
+	return c, ""
+}
+
+// Rect returns the region within the bounds to crop to. The region is limited
+// to the bounds, and is moved so that it's entirely within them.
+func (c *Crop) Rect(bounds image.Rectangle) image.Rectangle {
+	size := bounds.Size()
+
+	var width, height int
+	if c.Ratio > 0 {
+		if float64(size.X)/float64(size.Y) > c.Ratio {
+			width, height = int(math.Round(float64(size.Y)*c.Ratio)), size.Y
+		} else {
+			width, height = size.X, int(math.Round(float64(size.X)/c.Ratio))
+		}
+	} else {
+		width, height = c.Width.Pixels(size.X), c.Height.Pixels(size.Y)
+	}
+
+	width = max(min(width, size.X), 1)
+	height = max(min(height, size.Y), 1)
+
+	x := int(math.Round(float64(size.X-width) * c.OffsetX))
+	if c.X != nil {
+		x = c.X.Pixels(size.X)
+	}
+
+	y := int(math.Round(float64(size.Y-height) * c.OffsetY))
+	if c.Y != nil {
+		y = c.Y.Pixels(size.Y)
+	}
+
+	x = max(min(x, size.X-width), 0)
+	y = max(min(y, size.Y-height), 0)
+
+	return image.Rect(x, y, x+width, y+height).Add(bounds.Min)
+}
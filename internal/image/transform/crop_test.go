@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCropRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 200, 100)
+
+	tests := []struct {
+		name     string
+		crop     string
+		expected image.Rectangle
+	}{
+		{"centered", "100,50", image.Rect(50, 25, 150, 75)},
+		{"larger than the image", "400,400", image.Rect(0, 0, 200, 100)},
+		{"percentages", "50p,50p", image.Rect(50, 25, 150, 75)},
+		{"position", "100,50,x10,y20", image.Rect(10, 20, 110, 70)},
+		{"position percentages", "100,50,x10p,y20p", image.Rect(20, 20, 120, 70)},
+		{"position outside the image", "100,50,x150,y80", image.Rect(100, 50, 200, 100)},
+		{"offsets", "100,50,offset-x0,offset-y100", image.Rect(0, 50, 100, 100)},
+		{"offset and position", "100,50,offset-x100,y0", image.Rect(100, 0, 200, 50)},
+		{"anchor", "100,50,bottom-right", image.Rect(100, 50, 200, 100)},
+		{"anchor top", "100,50,top", image.Rect(50, 0, 150, 50)},
+		{"aspect ratio", "1:1", image.Rect(50, 0, 150, 100)},
+		{"aspect ratio taller", "1:2", image.Rect(75, 0, 125, 100)},
+		{"aspect ratio wider", "4:1", image.Rect(0, 25, 200, 75)},
+		{"aspect ratio with anchor", "16:9,left", image.Rect(0, 0, 178, 100)},
+		{"aspect ratio with offset", "1:1,offset-x25", image.Rect(25, 0, 125, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, message := parseCrop(tt.crop)
+			if message != "" {
+				t.Fatalf("Expected no error, got %s", message)
+			}
+
+			if rect := c.Rect(bounds); rect != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, rect)
+			}
+
+			// The region is relative to the bounds of the image.
+			offset := image.Pt(10, 10)
+			if rect := c.Rect(bounds.Add(offset)); rect != tt.expected.Add(offset) {
+				t.Errorf("Expected %v, got %v", tt.expected.Add(offset), rect)
+			}
+		})
+	}
+}
+
+func TestParseCropInvalid(t *testing.T) {
+	tests := []string{
+		"abc",
+		"10",
+		"0,10",
+		"10,-10",
+		"150p,10",
+		"0:1",
+		"a:b",
+		"10,10,x-1",
+		"10,10,offset-x101",
+		"10,10,middle",
+		"10,10,x1,x2",
+		"10,10,offset-y1,y2",
+		"10,10,top,x2",
+		"16:9,left,right",
+	}
+
+	for _, crop := range tests {
+		t.Run(crop, func(t *testing.T) {
+			if _, message := parseCrop(crop); message == "" {
+				t.Errorf("Expected an error for crop=%s, got none", crop)
+			}
+		})
+	}
+}
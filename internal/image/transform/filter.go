@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// The filters that change the colors of the image.
+const (
+	FilterGrayscale = "grayscale"
+	FilterSepia     = "sepia"
+	FilterInvert    = "invert"
+)
+
+// filters are the values of the filter parameter.
+var filters = []string{FilterGrayscale, FilterSepia, FilterInvert}
+
+// Duotone maps the luminance of the image onto the gradient between two
+// colors.
+type Duotone struct {
+	// Shadow is the color of the darkest parts of the image.
+	Shadow color.NRGBA
+
+	// Highlight is the color of the lightest parts of the image.
+	Highlight color.NRGBA
+}
+
+// parseDuotone parses the duotone in the form `{shadow},{highlight}` where
+// both of the colors are hex colors.
+func parseDuotone(value string) (*Duotone, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	shadow, ok := ParseColor(parts[0])
+	if !ok {
+		return nil, false
+	}
+
+	highlight, ok := ParseColor(parts[1])
+	if !ok {
+		return nil, false
+	}
+
+	return &Duotone{
+		Shadow:    shadow.(color.NRGBA),
+		Highlight: highlight.(color.NRGBA),
+	}, true
+}
+
+// mix returns the channel mixed from a to b by t from 0 to 1.
+func mix(a, b uint8, t float64) uint8 {
+	return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+}
+
+// clampChannel rounds the value and limits it to a color channel.
+func clampChannel(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+
+	if v > 255 {
+		return 255
+	}
+
+	return uint8(v + 0.5)
+}
+
+// =============================================================================
+
+// Colors are the color filters applied to the image, where the zero value does
+// not change it.
+type Colors struct {
+	// Filter is the named filter applied to the image, which is empty when
+	// it's not provided.
+	Filter string
+
+	// Duotone is the duotone applied to the image, which is nil when it's not
+	// provided.
+	Duotone *Duotone
+
+	// Tint is the color that the image is multiplied by, where its alpha is
+	// the strength of the tint, which is nil when it's not provided.
+	Tint color.Color
+}
+
+// SepiaImage applies the sepia tone to the image.
+func SepiaImage(m image.Image) *image.NRGBA {
+	return imaging.AdjustFunc(m, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+
+		return color.NRGBA{
+			R: clampChannel(0.393*r + 0.769*g + 0.189*b),
+			G: clampChannel(0.349*r + 0.686*g + 0.168*b),
+			B: clampChannel(0.272*r + 0.534*g + 0.131*b),
+			A: c.A,
+		}
+	})
+}
+
+// DuotoneImage replaces the colors of the image with the gradient from the
+// shadow to the highlight of the duotone by their luminance.
+func DuotoneImage(m image.Image, d *Duotone) *image.NRGBA {
+	return imaging.AdjustFunc(m, func(c color.NRGBA) color.NRGBA {
+		l := luminance([]uint8{c.R, c.G, c.B}, 0) / 255
+
+		return color.NRGBA{
+			R: mix(d.Shadow.R, d.Highlight.R, l),
+			G: mix(d.Shadow.G, d.Highlight.G, l),
+			B: mix(d.Shadow.B, d.Highlight.B, l),
+			A: c.A,
+		}
+	})
+}
+
+// TintImage multiplies the colors of the image by the tint, mixed with the
+// original colors by the alpha of the tint.
+func TintImage(m image.Image, tint color.Color) *image.NRGBA {
+	t := color.NRGBAModel.Convert(tint).(color.NRGBA)
+	strength := float64(t.A) / 255
+
+	return imaging.AdjustFunc(m, func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{
+			R: mix(c.R, uint8(int(c.R)*int(t.R)/255), strength),
+			G: mix(c.G, uint8(int(c.G)*int(t.G)/255), strength),
+			B: mix(c.B, uint8(int(c.B)*int(t.B)/255), strength),
+			A: c.A,
+		}
+	})
+}
+
+// ColorImage applies the color filters to the image in the order of the
+// filter, duotone and then tint.
+func ColorImage(m image.Image, c *Colors) image.Image {
+	switch c.Filter {
+	case FilterGrayscale:
+		m = imaging.Grayscale(m)
+	case FilterSepia:
+		m = SepiaImage(m)
+	case FilterInvert:
+		m = imaging.Invert(m)
+	}
+
+	if c.Duotone != nil {
+		m = DuotoneImage(m, c.Duotone)
+	}
+
+	if c.Tint != nil {
+		m = TintImage(m, c.Tint)
+	}
+
+	return m
+}
@@ -0,0 +1,67 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColorImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		colors Colors
+	}{
+		{"grayscale", Colors{Filter: FilterGrayscale}},
+		{"sepia", Colors{Filter: FilterSepia}},
+		{"invert", Colors{Filter: FilterInvert}},
+		{"duotone", Colors{Duotone: &Duotone{Shadow: color.NRGBA{R: 32, G: 0, B: 96, A: 255}, Highlight: color.NRGBA{R: 255, G: 200, B: 64, A: 255}}}},
+		{"tint", Colors{Tint: color.NRGBA{R: 255, G: 128, B: 0, A: 128}}},
+		{"chain", Colors{Filter: FilterInvert, Tint: color.NRGBA{R: 0, G: 128, B: 255, A: 255}}},
+	}
+
+	m := scene(64, 48, image.Rect(16, 8, 48, 40))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden(t, "color-"+tt.name, ColorImage(m, &tt.colors))
+		})
+	}
+}
+
+func TestDuotoneImage(t *testing.T) {
+	d := &Duotone{Shadow: color.NRGBA{R: 10, G: 20, B: 30, A: 255}, Highlight: color.NRGBA{R: 200, G: 210, B: 220, A: 255}}
+
+	m := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{A: 255})
+	m.SetNRGBA(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 100})
+
+	out := DuotoneImage(m, d)
+	if c := out.NRGBAAt(0, 0); c != d.Shadow {
+		t.Errorf("Expected black to become the shadow %v, got %v", d.Shadow, c)
+	}
+
+	if c, expected := out.NRGBAAt(1, 0), (color.NRGBA{R: 200, G: 210, B: 220, A: 100}); c != expected {
+		t.Errorf("Expected white to become the highlight %v, got %v", expected, c)
+	}
+}
+
+func TestParseDuotone(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"000080,ffd700", true},
+		{"#000,#fff", true},
+		{"000080", false},
+		{"000080,ffd700,fff", false},
+		{"000080,xyz", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, ok := parseDuotone(tt.value); ok != tt.ok {
+				t.Errorf("Expected %q to be valid to be %v, got %v", tt.value, tt.ok, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package transform
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// FocalPoint is the point in the image that is kept in frame when it's
+// cropped, from 0 to 1 relative to the width and height of the image.
+type FocalPoint struct {
+	X, Y float64
+}
+
+// String returns the focal point in the form {x},{y}.
+func (f *FocalPoint) String() string {
+	return fmt.Sprintf("%g,%g", f.X, f.Y)
+}
+
+// Rect returns the region with the width and height within the bounds that is
+// centered on the focal point, moved so that it's entirely within them.
+func (f *FocalPoint) Rect(bounds image.Rectangle, width, height int) image.Rectangle {
+	size := bounds.Size()
+
+	width = max(min(width, size.X), 1)
+	height = max(min(height, size.Y), 1)
+
+	x := int(math.Round(f.X*float64(size.X) - float64(width)/2))
+	y := int(math.Round(f.Y*float64(size.Y) - float64(height)/2))
+
+	x = max(min(x, size.X-width), 0)
+	y = max(min(y, size.Y-height), 0)
+
+	return image.Rect(x, y, x+width, y+height).Add(bounds.Min)
+}
+
+// Within returns the focal point relative to the region of the bounds, such as
+// after the image was cropped to it. The point is limited to the region when
+// it's outside of it.
+func (f *FocalPoint) Within(bounds, region image.Rectangle) *FocalPoint {
+	size := bounds.Size()
+
+	x := (f.X*float64(size.X) - float64(region.Min.X-bounds.Min.X)) / float64(region.Dx())
+	y := (f.Y*float64(size.Y) - float64(region.Min.Y-bounds.Min.Y)) / float64(region.Dy())
+
+	return &FocalPoint{
+		X: math.Max(math.Min(x, 1), 0),
+		Y: math.Max(math.Min(y, 1), 0),
+	}
+}
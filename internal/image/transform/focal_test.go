@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"image"
+	"net/url"
+	"testing"
+)
+
+func TestFocalPointRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 200, 100)
+
+	tests := []struct {
+		name     string
+		focus    FocalPoint
+		expected image.Rectangle
+	}{
+		{"center", FocalPoint{0.5, 0.5}, image.Rect(75, 25, 125, 75)},
+		{"top left", FocalPoint{0, 0}, image.Rect(0, 0, 50, 50)},
+		{"bottom right", FocalPoint{1, 1}, image.Rect(150, 50, 200, 100)},
+		{"off center", FocalPoint{0.25, 0.6}, image.Rect(25, 35, 75, 85)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rect := tt.focus.Rect(bounds, 50, 50); rect != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, rect)
+			}
+		})
+	}
+}
+
+func TestFocalPointWithin(t *testing.T) {
+	focus := &FocalPoint{0.25, 0.5}
+
+	within := focus.Within(image.Rect(0, 0, 200, 100), image.Rect(0, 0, 100, 100))
+	if *within != (FocalPoint{0.5, 0.5}) {
+		t.Errorf("Expected the focal point 0.5,0.5, got %v", within)
+	}
+
+	// The focal point is limited to the region when it's outside of it.
+	within = focus.Within(image.Rect(0, 0, 200, 100), image.Rect(100, 0, 200, 100))
+	if *within != (FocalPoint{0, 0.5}) {
+		t.Errorf("Expected the focal point 0,0.5, got %v", within)
+	}
+}
+
+func TestImageFocalPoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		point image.Point
+	}{
+		{"crop", "crop=1:1&fp-x=0.8", image.Pt(100, 100)},
+		{"crop overrides smart", "crop=1:1,smart&fp-x=0.8", image.Pt(100, 100)},
+		{"fit crop", "width=50&height=50&fit=crop&fp-x=0.8", image.Pt(25, 25)},
+		{"crop and fit crop", "crop=300,200,left&width=50&height=50&fit=crop&fp-x=0.8", image.Pt(49, 25)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The subject is on the right side of the image, where the focal
+			// point is.
+			subject := image.Rect(280, 60, 380, 160)
+			src := scene(400, 200, subject)
+
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			m, err := Image(src, o)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			// The point would show the background if the focal point was
+			// ignored.
+			if c := m.At(tt.point.X, tt.point.Y); c == src.At(0, 0) {
+				t.Errorf("Expected %v to show the subject, got %v", tt.point, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomediumitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+	"golang.org/x/image/font/gofont/gosmallcapsitalic"
+	"golang.org/x/image/font/opentype"
+)
+
+// DefaultFont is the font used for text when it's not provided.
+const DefaultFont = "regular"
+
+// fontExtensions are the extensions of the font files loaded from a font
+// directory.
+var fontExtensions = map[string]bool{
+	".ttf": true,
+	".otf": true,
+}
+
+// fonts are the fonts that can be selected by name, which are the Go fonts
+// shipped in the binary and the fonts loaded with LoadFonts.
+var fonts = map[string]*opentype.Font{}
+
+// builtinFonts are the TrueType data of the Go fonts, which are parsed when
+// they are first used.
+var builtinFonts = map[string][]byte{
+	"regular":          goregular.TTF,
+	"bold":             gobold.TTF,
+	"italic":           goitalic.TTF,
+	"bold-italic":      gobolditalic.TTF,
+	"medium":           gomedium.TTF,
+	"medium-italic":    gomediumitalic.TTF,
+	"mono":             gomono.TTF,
+	"mono-bold":        gomonobold.TTF,
+	"mono-italic":      gomonoitalic.TTF,
+	"mono-bold-italic": gomonobolditalic.TTF,
+	"smallcaps":        gosmallcaps.TTF,
+	"smallcaps-italic": gosmallcapsitalic.TTF,
+}
+
+// fontsMu protects the fonts.
+var fontsMu sync.RWMutex
+
+// LoadFonts loads the TrueType and OpenType fonts (`.ttf` and `.otf`) from the
+// directory, which can then be selected by their lowercased filename without
+// the extension. Fonts with the same name as a Go font replace it.
+func LoadFonts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read the font directory")
+	}
+
+	loaded := make(map[string]*opentype.Font)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !fontExtensions[ext] {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read the font %s", entry.Name())
+		}
+
+		f, err := opentype.Parse(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't parse the font %s", entry.Name())
+		}
+
+		loaded[strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))] = f
+	}
+
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+
+	names := make([]string, 0, len(loaded))
+	for name, f := range loaded {
+		fonts[name] = f
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// FontNames returns the sorted names of the fonts that can be selected.
+func FontNames() []string {
+	fontsMu.RLock()
+	defer fontsMu.RUnlock()
+
+	known := make(map[string]bool, len(builtinFonts)+len(fonts))
+	for name := range builtinFonts {
+		known[name] = true
+	}
+
+	for name := range fonts {
+		known[name] = true
+	}
+
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// getFont returns the font with the name, parsing the Go font when it's first
+// used.
+func getFont(name string) (*opentype.Font, error) {
+	fontsMu.RLock()
+	f, ok := fonts[name]
+	fontsMu.RUnlock()
+
+	if ok {
+		return f, nil
+	}
+
+	data, ok := builtinFonts[name]
+	if !ok {
+		return nil, errors.Errorf("unknown font %s", name)
+	}
+
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse the font %s", name)
+	}
+
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+
+	// Another request may have parsed the font first, or it may have been
+	// replaced by a loaded font.
+	if existing, ok := fonts[name]; ok {
+		return existing, nil
+	}
+
+	fonts[name] = f
+
+	return f, nil
+}
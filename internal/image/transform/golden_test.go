@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata")
+
+// golden compares the image with the golden image of the name in testdata,
+// writing the golden image instead when -update is provided.
+func golden(t *testing.T, name string, m image.Image) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".png")
+
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, m); err != nil {
+			t.Fatalf("Failed to encode the golden image: %v", err)
+		}
+
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write the golden image: %v", err)
+		}
+
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open the golden image, run with -update to create it: %v", err)
+	}
+	defer f.Close()
+
+	expected, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Failed to decode the golden image: %v", err)
+	}
+
+	e, a := imaging.Clone(expected), imaging.Clone(m)
+	if e.Bounds().Size() != a.Bounds().Size() {
+		t.Fatalf("Expected the size %v, got %v", e.Bounds().Size(), a.Bounds().Size())
+	}
+
+	if !bytes.Equal(e.Pix, a.Pix) {
+		t.Errorf("Expected the image to match the golden image %s", path)
+	}
+}
+
+// scene draws a deterministic image with a flat background and a detailed,
+// colorful subject in the region.
+func scene(width, height int, subject image.Rectangle) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := m.PixOffset(x, y)
+			m.Pix[i], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3] = 120, 130, 140, 255
+
+			if (image.Point{x, y}).In(subject) {
+				v := uint8((x*37 + y*91 + x*y) % 256)
+				m.Pix[i], m.Pix[i+1], m.Pix[i+2] = v, 255-v, uint8(x*y%256)
+			}
+		}
+	}
+
+	return m
+}
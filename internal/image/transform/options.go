@@ -0,0 +1,417 @@
+package transform
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// MaxDimension is the largest width or height that an image can be resized to.
+const MaxDimension = 8192
+
+// MaxDPR is the largest device pixel ratio that the dimensions can be scaled
+// by.
+const MaxDPR = 10
+
+// ParamError describes a query parameter that could not be used.
+type ParamError struct {
+	Param   string `json:"param"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s=%s: %s", e.Param, e.Value, e.Message)
+}
+
+// ParamErrors is the list of every query parameter that could not be used.
+type ParamErrors []*ParamError
+
+func (e ParamErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return "invalid parameters: " + strings.Join(messages, ", ")
+}
+
+// =============================================================================
+
+// Options are the transformations to apply to the image, parsed from the query
+// parameters.
+type Options struct {
+	// Crop is the region of the image to crop to, which is nil when not
+	// cropping.
+	Crop *Crop
+
+	// Width and Height are the dimensions to resize the image to, which are
+	// zero when not provided.
+	Width, Height int
+
+	// Fit is how the image is constrained when both the Width and Height are
+	// provided.
+	Fit string
+
+	// Upscale permits enlarging images that are smaller than the width or
+	// height when only one of them is provided.
+	Upscale bool
+
+	// CropMode is how the region is chosen when cropping smartly or with the
+	// crop fit, which is empty when it's not provided.
+	CropMode string
+
+	// Focus is the focal point that is kept in frame when the image is cropped
+	// without a position, which is nil when it's not known.
+	Focus *FocalPoint
+
+	// Filter is the resample filter used when resizing.
+	Filter imaging.ResampleFilter
+
+	// Orient is the orientation to apply to the image.
+	Orient string
+
+	// Adjustments are the color and tone adjustments applied to the image.
+	Adjustments Adjustments
+
+	// Colors are the color filters applied to the image.
+	Colors Colors
+
+	// Blur is the sigma of the Gaussian blur applied to the image, which is
+	// zero when not blurring.
+	Blur float64
+
+	// Overlay is the image composited over the image, which is nil when it's
+	// not provided.
+	Overlay *Overlay
+
+	// Text is the text drawn over the image, which is nil when it's not
+	// provided.
+	Text *Text
+
+	// Pad is the padding added around the image, which is nil when not
+	// padding.
+	Pad *Padding
+
+	// Canvas is the canvas that the image is placed on, which is nil when
+	// it's not placed on a canvas.
+	Canvas *Crop
+
+	// Background is the color of the padding and the canvas, which is nil when
+	// they are transparent.
+	Background color.Color
+}
+
+// Cropped returns true when the image is cropped to a region that is chosen
+// around the focal point when it's known, which is when it's cropped without a
+// position or to cover the width and height.
+func (o *Options) Cropped() bool {
+	if o.Crop != nil && !o.Crop.Positioned {
+		return true
+	}
+
+	return o.Width > 0 && o.Height > 0 && (o.Fit == "cover" || o.Fit == "crop")
+}
+
+// Params are the query parameters used by the transformations.
+var Params = []string{
+	"crop",
+	"width",
+	"height",
+	"dpr",
+	"fit",
+	"enable",
+	"crop-mode",
+	"fp-x",
+	"fp-y",
+	"resize-filter",
+	"orient",
+	"brightness",
+	"contrast",
+	"saturation",
+	"gamma",
+	"sharpen",
+	"filter",
+	"duotone",
+	"tint",
+	"blur",
+	"overlay",
+	"overlay-pos",
+	"overlay-opacity",
+	"overlay-width",
+	"overlay-margin",
+	"txt",
+	"txt-size",
+	"txt-color",
+	"txt-font",
+	"txt-align",
+	"txt-pad",
+	"txt-width",
+	"txt-shadow",
+	"pad",
+	"canvas",
+	"bg-color",
+}
+
+// Parser parses query parameters, collecting the errors for every parameter
+// that could not be used.
+type Parser struct {
+	Values url.Values
+	Errors ParamErrors
+}
+
+// Fail records that the parameter could not be used.
+func (p *Parser) Fail(param, message string) {
+	p.Errors = append(p.Errors, &ParamError{
+		Param:   param,
+		Value:   p.Values.Get(param),
+		Message: message,
+	})
+}
+
+// Int parses the parameter as an integer between min and max inclusive,
+// returning zero when it's not provided or is invalid.
+func (p *Parser) Int(param string, min, max int) int {
+	value := p.Values.Get(param)
+	if value == "" {
+		return 0
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < min || i > max {
+		p.Fail(param, fmt.Sprintf("must be an integer between %d and %d", min, max))
+		return 0
+	}
+
+	return i
+}
+
+// Float parses the parameter as a number greater than min and less than or
+// equal to max, returning zero when it's not provided or is invalid.
+func (p *Parser) Float(param string, min, max float64) float64 {
+	value := p.Values.Get(param)
+	if value == "" {
+		return 0
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= min || f > max {
+		p.Fail(param, fmt.Sprintf("must be a number greater than %g and at most %g", min, max))
+		return 0
+	}
+
+	return f
+}
+
+// Number parses the parameter as a number between min and max inclusive,
+// returning false when it's not provided or is invalid.
+func (p *Parser) Number(param string, min, max float64) (float64, bool) {
+	value := p.Values.Get(param)
+	if value == "" {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < min || f > max {
+		p.Fail(param, fmt.Sprintf("must be a number between %g and %g", min, max))
+		return 0, false
+	}
+
+	return f, true
+}
+
+// Bool parses the parameter as a boolean, returning false when it's not
+// provided or is invalid.
+func (p *Parser) Bool(param string) bool {
+	value := p.Values.Get(param)
+	if value == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.Fail(param, "must be true or false")
+		return false
+	}
+
+	return b
+}
+
+// Enum parses the parameter as one of the values, returning an empty string
+// when it's not provided or is invalid.
+func (p *Parser) Enum(param string, values ...string) string {
+	value := p.Values.Get(param)
+	if value == "" {
+		return ""
+	}
+
+	for _, v := range values {
+		if value == v {
+			return value
+		}
+	}
+
+	p.Fail(param, "must be one of "+strings.Join(values, ", "))
+
+	return ""
+}
+
+// =============================================================================
+
+// resampleFilters are the resample filters that can be selected by name.
+var resampleFilters = map[string]imaging.ResampleFilter{
+	"lanczos":   imaging.Lanczos,
+	"nearest":   imaging.NearestNeighbor,
+	"linear":    imaging.Linear,
+	"netravali": imaging.MitchellNetravali,
+	"box":       imaging.Box,
+	"gaussian":  imaging.Gaussian,
+}
+
+// orientations are the supported values for the orient parameter.
+var orientations = []string{"r", "l", "h", "v", "hv", "vh", "1", "2", "3", "4", "5", "6", "7", "8"}
+
+// ParseOptions parses the transformation options from the query parameters,
+// returning ParamErrors listing every parameter that is invalid.
+func ParseOptions(v url.Values) (*Options, error) {
+	p := &Parser{Values: v}
+	o := ParseOptionsWith(p)
+
+	if len(p.Errors) > 0 {
+		return nil, p.Errors
+	}
+
+	return o, nil
+}
+
+// ParseOptionsWith parses the transformation options with the parser, which
+// collects the errors for the parameters that are invalid.
+func ParseOptionsWith(p *Parser) *Options {
+	o := &Options{Filter: imaging.Lanczos}
+
+	if crop := p.Values.Get("crop"); crop != "" {
+		c, message := parseCrop(crop)
+		if message != "" {
+			p.Fail("crop", message)
+		}
+
+		o.Crop = c
+	}
+
+	// The dimensions are scaled by the device pixel ratio, and dimensions
+	// larger than the maximum are limited to it rather than being rejected.
+	dpr, ok := p.Number("dpr", 1, MaxDPR)
+	if !ok {
+		dpr = 1
+	}
+
+	o.Width = int(math.Round(math.Min(float64(p.Int("width", 1, math.MaxInt))*dpr, MaxDimension)))
+	o.Height = int(math.Round(math.Min(float64(p.Int("height", 1, math.MaxInt))*dpr, MaxDimension)))
+	o.Fit = p.Enum("fit", "cover", "bounds", "crop", "fill")
+	o.Upscale = p.Enum("enable", "upscale") == "upscale"
+	o.CropMode = p.Enum("crop-mode", CropModeCenter, CropModeEntropy, CropModeAttention)
+
+	if o.Crop != nil && o.Crop.Mode != "" {
+		if o.CropMode != "" {
+			o.Crop.Mode = o.CropMode
+		}
+
+		// A smart crop without dimensions uses the aspect ratio of the
+		// requested size.
+		if o.Crop.Ratio == 0 && o.Crop.Width.Value == 0 {
+			if o.Width > 0 && o.Height > 0 {
+				o.Crop.Ratio = float64(o.Width) / float64(o.Height)
+			} else {
+				p.Fail("crop", "must have dimensions or be used with width and height")
+			}
+		}
+	}
+
+	if filter := p.Enum("resize-filter", "lanczos", "nearest", "linear", "netravali", "box", "gaussian"); filter != "" {
+		o.Filter = resampleFilters[filter]
+	}
+
+	// The focal point is centered on the axis that is not provided.
+	x, xOk := p.Number("fp-x", 0, 1)
+	y, yOk := p.Number("fp-y", 0, 1)
+	if xOk || yOk {
+		o.Focus = &FocalPoint{X: 0.5, Y: 0.5}
+		if xOk {
+			o.Focus.X = x
+		}
+		if yOk {
+			o.Focus.Y = y
+		}
+	}
+
+	o.Orient = p.Enum("orient", orientations...)
+	o.Adjustments.Brightness, _ = p.Number("brightness", -100, 100)
+	o.Adjustments.Contrast, _ = p.Number("contrast", -100, 100)
+	o.Adjustments.Saturation, _ = p.Number("saturation", -100, 100)
+	o.Adjustments.Gamma, _ = p.Number("gamma", 0.1, 10)
+
+	if sharpen := p.Values.Get("sharpen"); sharpen != "" {
+		if s, ok := parseSharpen(sharpen); ok {
+			o.Adjustments.Sharpen = s
+		} else {
+			p.Fail("sharpen", "must be in the form a{amount},r{radius},t{threshold} with an amount from 0 to 10, a radius from 0.5 to 1000 and a threshold from 0 to 255")
+		}
+	}
+
+	o.Colors.Filter = p.Enum("filter", filters...)
+
+	if duotone := p.Values.Get("duotone"); duotone != "" {
+		if o.Colors.Duotone, _ = parseDuotone(duotone); o.Colors.Duotone == nil {
+			p.Fail("duotone", "must be two hex colors in the form {shadow},{highlight}")
+		}
+	}
+
+	if tint := p.Values.Get("tint"); tint != "" {
+		if o.Colors.Tint, _ = ParseColor(tint); o.Colors.Tint == nil {
+			p.Fail("tint", "must be a hex color or in the form {r},{g},{b} or {r},{g},{b},{a}")
+		}
+	}
+
+	o.Blur = p.Float("blur", 0, 1000)
+
+	o.Overlay = parseOverlay(p)
+	o.Text = parseText(p)
+
+	if pad := p.Values.Get("pad"); pad != "" {
+		if o.Pad, _ = parsePadding(pad); o.Pad == nil {
+			p.Fail("pad", fmt.Sprintf("must be 1 to 4 comma separated non-negative integers of at most %d or percentages in the form {n}p", MaxDimension))
+		}
+	}
+
+	if canvas := p.Values.Get("canvas"); canvas != "" {
+		c, message := parseCrop(canvas)
+		switch {
+		case message != "":
+		case c.Mode != "":
+			message = "can't be smart"
+		case c.Ratio > MaxDimension || (c.Ratio > 0 && c.Ratio < 1.0/MaxDimension):
+			message = fmt.Sprintf("must have an aspect ratio between 1:%d and %d:1", MaxDimension, MaxDimension)
+		case (!c.Width.Percent && c.Width.Value > MaxDimension) || (!c.Height.Percent && c.Height.Value > MaxDimension):
+			message = fmt.Sprintf("can't be larger than %dx%d", MaxDimension, MaxDimension)
+		}
+
+		if message != "" {
+			p.Fail("canvas", message)
+		} else {
+			o.Canvas = c
+		}
+	}
+
+	if bg := p.Values.Get("bg-color"); bg != "" {
+		if o.Background, _ = ParseColor(bg); o.Background == nil {
+			p.Fail("bg-color", "must be a hex color or in the form {r},{g},{b} or {r},{g},{b},{a}")
+		}
+	}
+
+	return o
+}
@@ -0,0 +1,131 @@
+package transform
+
+import (
+	"errors"
+	"image/color"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected *Options
+	}{
+		{"empty", "", &Options{Filter: imaging.Lanczos}},
+		{"crop", "crop=10,20", &Options{Crop: &Crop{Width: Length{Value: 10}, Height: Length{Value: 20}, OffsetX: 0.5, OffsetY: 0.5}, Filter: imaging.Lanczos}},
+		{"resize", "width=10&height=20&fit=bounds&resize-filter=box", &Options{Width: 10, Height: 20, Fit: "bounds", Filter: imaging.Box}},
+		{"limited dimensions", "width=10000", &Options{Width: MaxDimension, Filter: imaging.Lanczos}},
+		{"dpr", "width=100&height=51&dpr=1.5", &Options{Width: 150, Height: 77, Filter: imaging.Lanczos}},
+		{"dpr limited dimensions", "width=5000&dpr=2", &Options{Width: MaxDimension, Filter: imaging.Lanczos}},
+		{"smart crop", "crop=smart&width=20&height=10&crop-mode=attention", &Options{Crop: &Crop{Ratio: 2, OffsetX: 0.5, OffsetY: 0.5, Mode: CropModeAttention}, Width: 20, Height: 10, CropMode: CropModeAttention, Filter: imaging.Lanczos}},
+		{"focal point", "fp-x=0.2&fp-y=1", &Options{Focus: &FocalPoint{X: 0.2, Y: 1}, Filter: imaging.Lanczos}},
+		{"focal point on one axis", "fp-y=0", &Options{Focus: &FocalPoint{X: 0.5, Y: 0}, Filter: imaging.Lanczos}},
+		{"orient and blur", "orient=hv&blur=1.5", &Options{Orient: "hv", Blur: 1.5, Filter: imaging.Lanczos}},
+		{"adjustments", "brightness=10&contrast=-20.5&saturation=-100&gamma=2.2", &Options{Adjustments: Adjustments{Brightness: 10, Contrast: -20.5, Saturation: -100, Gamma: 2.2}, Filter: imaging.Lanczos}},
+		{"sharpen", "sharpen=a5,r2,t10", &Options{Adjustments: Adjustments{Sharpen: &Sharpen{Amount: 5, Radius: 2, Threshold: 10}}, Filter: imaging.Lanczos}},
+		{"colors", "filter=sepia&duotone=000,fff&tint=ff000080", &Options{Colors: Colors{Filter: FilterSepia, Duotone: &Duotone{Shadow: color.NRGBA{A: 255}, Highlight: color.NRGBA{R: 255, G: 255, B: 255, A: 255}}, Tint: color.NRGBA{R: 255, A: 128}}, Filter: imaging.Lanczos}},
+		{"overlay", "overlay=logo.png&overlay-opacity=50&overlay-width=25p&overlay-margin=10", &Options{Overlay: &Overlay{Filename: "logo.png", Position: "center", Opacity: 0.5, Width: Length{Value: 25, Percent: true}, Margin: Length{Value: 10}}, Filter: imaging.Lanczos}},
+		{"overlay tile", "overlay=logo.png&overlay-pos=tile", &Options{Overlay: &Overlay{Filename: "logo.png", Position: OverlayTile, Opacity: 1}, Filter: imaging.Lanczos}},
+		{"overlay options without overlay", "overlay-pos=top", &Options{Filter: imaging.Lanczos}},
+		{"text", "txt=Hello&txt-size=5p&txt-color=fff&txt-font=bold&txt-align=bottom-left&txt-pad=10&txt-width=50p&txt-shadow=2", &Options{Text: &Text{Value: "Hello", Size: Length{Value: 5, Percent: true}, Color: color.NRGBA{R: 255, G: 255, B: 255, A: 255}, Font: "bold", Align: "bottom-left", Pad: Length{Value: 10}, Width: Length{Value: 50, Percent: true}, Shadow: 2}, Filter: imaging.Lanczos}},
+		{"text defaults", "txt=Hello", &Options{Text: &Text{Value: "Hello", Size: Length{Value: 24}, Color: color.Black, Font: DefaultFont, Align: "center"}, Filter: imaging.Lanczos}},
+		{"sharpen defaults", "sharpen=a1.5", &Options{Adjustments: Adjustments{Sharpen: &Sharpen{Amount: 1.5, Radius: 1}}, Filter: imaging.Lanczos}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			// The resample filters contain functions which can't be compared, so
+			// they are compared by their support instead.
+			if o.Filter.Support != tt.expected.Filter.Support {
+				t.Errorf("Expected filter support %v, got %v", tt.expected.Filter.Support, o.Filter.Support)
+			}
+
+			o.Filter, tt.expected.Filter = imaging.ResampleFilter{}, imaging.ResampleFilter{}
+
+			if !reflect.DeepEqual(o, tt.expected) {
+				t.Errorf("Expected options %+v, got %+v", tt.expected, o)
+			}
+		})
+	}
+}
+
+func TestParseOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"crop", "crop=abc", []string{"crop"}},
+		{"crop missing height", "crop=10", []string{"crop"}},
+		{"crop negative", "crop=-10,10", []string{"crop"}},
+		{"width", "width=abc", []string{"width"}},
+		{"height", "height=-1", []string{"height"}},
+		{"fit", "fit=stretch", []string{"fit"}},
+		{"dpr", "dpr=0.5", []string{"dpr"}},
+		{"enable", "enable=fast", []string{"enable"}},
+		{"crop mode", "crop-mode=faces", []string{"crop-mode"}},
+		{"smart crop without size", "crop=smart&width=10", []string{"crop"}},
+		{"resize filter", "resize-filter=bicubic", []string{"resize-filter"}},
+		{"focal point", "fp-x=1.5&fp-y=abc", []string{"fp-x", "fp-y"}},
+		{"orient", "orient=9", []string{"orient"}},
+		{"brightness", "brightness=101", []string{"brightness"}},
+		{"filter", "filter=blur", []string{"filter"}},
+		{"text", "txt=" + strings.Repeat("a", 1001) + "&txt-size=1001&txt-font=comic&txt-align=tile&txt-shadow=-1", []string{"txt-font", "txt-align", "txt", "txt-size", "txt-shadow"}},
+		{"overlay", "overlay=logo.png&overlay-pos=middle&overlay-opacity=101&overlay-width=0&overlay-margin=-1", []string{"overlay-pos", "overlay-opacity", "overlay-width", "overlay-margin"}},
+		{"duotone", "duotone=000", []string{"duotone"}},
+		{"tint", "tint=red", []string{"tint"}},
+		{"gamma", "gamma=0", []string{"gamma"}},
+		{"sharpen without amount", "sharpen=r2", []string{"sharpen"}},
+		{"sharpen out of range", "sharpen=a11", []string{"sharpen"}},
+		{"sharpen unknown", "sharpen=a1,x2", []string{"sharpen"}},
+		{"blur", "blur=-3", []string{"blur"}},
+		{"pad", "pad=1,2,3,4,5", []string{"pad"}},
+		{"canvas", "canvas=abc", []string{"canvas"}},
+		{"pad too large", "pad=2000000000", []string{"pad"}},
+		{"smart canvas", "canvas=1:1,smart", []string{"canvas"}},
+		{"canvas too large", "canvas=100000,100000", []string{"canvas"}},
+		{"canvas ratio too tall", "canvas=1:100000000", []string{"canvas"}},
+		{"canvas ratio too wide", "canvas=10000:1", []string{"canvas"}},
+		{"bg color", "bg-color=red", []string{"bg-color"}},
+		{"multiple", "crop=abc&blur=0&fit=stretch", []string{"crop", "fit", "blur"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			_, err := ParseOptions(v)
+
+			var errs ParamErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected ParamErrors, got %v", err)
+			}
+
+			var params []string
+			for _, e := range errs {
+				params = append(params, e.Param)
+
+				if e.Value != v.Get(e.Param) || e.Message == "" {
+					t.Errorf("Expected the error for %s to describe the value, got %+v", e.Param, e)
+				}
+			}
+
+			if !reflect.DeepEqual(params, tt.expected) {
+				t.Errorf("Expected errors for %v, got %v", tt.expected, params)
+			}
+		})
+	}
+}
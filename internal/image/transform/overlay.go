@@ -0,0 +1,158 @@
+package transform
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+)
+
+// OverlayTile is the position of the overlay that repeats it over the whole
+// image.
+const OverlayTile = "tile"
+
+// overlayPositions are the values of the overlay-pos parameter.
+var overlayPositions = []string{
+	"top-left",
+	"top",
+	"top-right",
+	"left",
+	"center",
+	"right",
+	"bottom-left",
+	"bottom",
+	"bottom-right",
+	OverlayTile,
+}
+
+// Overlay is the image composited over the image, such as a watermark.
+type Overlay struct {
+	// Filename is the filename of the overlay image, which is loaded from the
+	// provider by the caller.
+	Filename string
+
+	// Image is the overlay image, which is nil until it's loaded by the
+	// caller.
+	Image image.Image
+
+	// Position is the anchor that the overlay is positioned at, or OverlayTile
+	// to repeat it over the image.
+	Position string
+
+	// Opacity is the opacity of the overlay from 0 to 1.
+	Opacity float64
+
+	// Width is the width of the overlay in pixels or as a percentage of the
+	// width of the image, where zero keeps the width of the overlay image.
+	Width Length
+
+	// Margin is the space between the overlay and the edges of the image, and
+	// between the tiles, in pixels or as a percentage of the size of the
+	// image.
+	Margin Length
+}
+
+// OverlayImage composites the overlay over the image. The overlay is resized
+// to its width keeping its aspect ratio, then positioned at its anchor inside
+// the margin or repeated over the image.
+func OverlayImage(m image.Image, o *Overlay) image.Image {
+	if o.Image == nil || o.Opacity <= 0 {
+		return m
+	}
+
+	bounds := m.Bounds()
+	overlay := o.Image
+	if o.Width.Value > 0 {
+		width := o.Width.Pixels(bounds.Dx())
+		if width < 1 {
+			width = 1
+		} else if width > MaxDimension {
+			width = MaxDimension
+		}
+
+		overlay = imaging.Resize(overlay, width, 0, imaging.Lanczos)
+	}
+
+	size := overlay.Bounds().Size()
+	if size.X < 1 || size.Y < 1 {
+		return m
+	}
+
+	marginX, marginY := o.Margin.Pixels(bounds.Dx()), o.Margin.Pixels(bounds.Dy())
+
+	if o.Position != OverlayTile {
+		anchor, ok := anchors[o.Position]
+		if !ok {
+			anchor = anchors["center"]
+		}
+
+		pos := image.Pt(
+			bounds.Min.X+marginX+int(float64(bounds.Dx()-2*marginX-size.X)*anchor[0]+0.5),
+			bounds.Min.Y+marginY+int(float64(bounds.Dy()-2*marginY-size.Y)*anchor[1]+0.5),
+		)
+
+		return imaging.Overlay(m, overlay, pos, o.Opacity)
+	}
+
+	// Draw the tiles onto a transparent layer so that the image is only
+	// composited once. Only the first tile is drawn, which is then copied along
+	// its row, and the row down the layer, so that small tiles are as fast as
+	// large ones.
+	layer := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(layer, image.Rect(marginX, marginY, marginX+size.X, marginY+size.Y), overlay, overlay.Bounds().Min, draw.Src)
+
+	for y := marginY; y < min(marginY+size.Y, bounds.Dy()); y++ {
+		row := layer.Pix[y*layer.Stride : (y+1)*layer.Stride]
+		repeat(row, marginX*4, (size.X+marginX)*4)
+	}
+
+	repeat(layer.Pix, marginY*layer.Stride, (size.Y+marginY)*layer.Stride)
+
+	return imaging.Overlay(m, layer, bounds.Min, o.Opacity)
+}
+
+// repeat repeats the period of the bytes starting at the offset over the rest
+// of them, doubling the bytes that are copied each time.
+func repeat(b []byte, offset, period int) {
+	for end := offset + period; end < len(b); {
+		end += copy(b[end:], b[offset:end])
+	}
+}
+
+// parseOverlay parses the overlay parameters, returning nil when the overlay
+// is not provided.
+func parseOverlay(p *Parser) *Overlay {
+	o := &Overlay{
+		Filename: p.Values.Get("overlay"),
+		Position: p.Enum("overlay-pos", overlayPositions...),
+		Opacity:  1,
+	}
+
+	if opacity, ok := p.Number("overlay-opacity", 0, 100); ok {
+		o.Opacity = opacity / 100
+	}
+
+	if width := p.Values.Get("overlay-width"); width != "" {
+		var ok bool
+		if o.Width, ok = parseLength(width, true); !ok {
+			p.Fail("overlay-width", "must be a positive integer or a percentage in the form {n}p")
+		}
+	}
+
+	if margin := p.Values.Get("overlay-margin"); margin != "" {
+		var ok bool
+		if o.Margin, ok = parseLength(margin, false); !ok {
+			p.Fail("overlay-margin", "must be a non-negative integer or a percentage in the form {n}p")
+		}
+	}
+
+	if o.Filename == "" {
+		return nil
+	}
+
+	if o.Position == "" {
+		o.Position = "center"
+	}
+
+	return o
+}
@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// logo draws a deterministic overlay with an opaque border and a translucent
+// center.
+func logo(width, height int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if x > 0 && y > 0 && x < width-1 && y < height-1 {
+				c = color.NRGBA{R: 200, G: 20, B: 40, A: 160}
+			}
+
+			m.SetNRGBA(x, y, c)
+		}
+	}
+
+	return m
+}
+
+func TestOverlayImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlay Overlay
+	}{
+		{"center", Overlay{Position: "center", Opacity: 1}},
+		{"bottom-right-margin", Overlay{Position: "bottom-right", Opacity: 1, Margin: Length{Value: 4}}},
+		{"opacity", Overlay{Position: "top-left", Opacity: 0.5}},
+		{"width", Overlay{Position: "top", Opacity: 1, Width: Length{Value: 50, Percent: true}}},
+		{"tile", Overlay{Position: OverlayTile, Opacity: 0.8, Margin: Length{Value: 3}}},
+	}
+
+	m := scene(64, 48, image.Rect(16, 8, 48, 40))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.overlay.Image = logo(12, 8)
+			golden(t, "overlay-"+tt.name, OverlayImage(m, &tt.overlay))
+		})
+	}
+}
+
+func TestOverlayImagePosition(t *testing.T) {
+	tests := []struct {
+		position string
+		margin   Length
+		expected image.Point
+	}{
+		{"top-left", Length{}, image.Pt(0, 0)},
+		{"center", Length{}, image.Pt(14, 16)},
+		{"bottom-right", Length{}, image.Pt(28, 32)},
+		{"bottom-right", Length{Value: 2}, image.Pt(26, 30)},
+		{"top-left", Length{Value: 10, Percent: true}, image.Pt(4, 4)},
+	}
+
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			m := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+			o := &Overlay{Image: logo(12, 8), Position: tt.position, Opacity: 1, Margin: tt.margin}
+
+			out := OverlayImage(m, o).(*image.NRGBA)
+			if c := out.NRGBAAt(tt.expected.X, tt.expected.Y); c != white {
+				t.Errorf("Expected the corner of the overlay at %v, got %v", tt.expected, c)
+			}
+
+			if tt.expected.X > 0 {
+				if c := out.NRGBAAt(tt.expected.X-1, tt.expected.Y); c == white {
+					t.Errorf("Expected the overlay to start at %v", tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlayImageUnchanged(t *testing.T) {
+	m := scene(16, 16, image.Rect(4, 4, 12, 12))
+
+	for _, o := range []*Overlay{{Opacity: 1}, {Image: logo(4, 4)}} {
+		if out := OverlayImage(m, o); out != image.Image(m) {
+			t.Errorf("Expected the image to be unchanged by %+v", o)
+		}
+	}
+}
+
+func TestOverlayImageSmallTiles(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 37, 23))
+	tile := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	tile.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+
+	out := OverlayImage(m, &Overlay{Image: tile, Position: OverlayTile, Opacity: 1, Margin: Length{Value: 2}})
+
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			expected := uint8(0)
+			if x%3 == 2 && y%3 == 2 {
+				expected = 255
+			}
+
+			if r := out.(*image.NRGBA).NRGBAAt(x, y).R; r != expected {
+				t.Fatalf("Expected the pixel at %d,%d to have red %d, got %d", x, y, expected, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// maxColors is the number of colors in the palette of a GIF frame.
+const maxColors = 256
+
+// colorBox is a box in the RGB color space used by the median cut.
+type colorBox struct {
+	colors []colorCount
+}
+
+// colorCount is a color and the number of pixels with it.
+type colorCount struct {
+	rgb   [3]uint8
+	count int
+}
+
+// widest returns the channel where the colors in the box span the most, and
+// that span.
+func (b *colorBox) widest() (int, int) {
+	channel, span := 0, -1
+	for c := 0; c < 3; c++ {
+		lo, hi := 255, 0
+		for _, cc := range b.colors {
+			lo, hi = min(lo, int(cc.rgb[c])), max(hi, int(cc.rgb[c]))
+		}
+
+		if hi-lo > span {
+			channel, span = c, hi-lo
+		}
+	}
+
+	return channel, span
+}
+
+// split splits the box at the median pixel along its widest channel.
+func (b *colorBox) split() (*colorBox, *colorBox) {
+	channel, _ := b.widest()
+	sort.Slice(b.colors, func(i, j int) bool {
+		return b.colors[i].rgb[channel] < b.colors[j].rgb[channel]
+	})
+
+	total := 0
+	for _, cc := range b.colors {
+		total += cc.count
+	}
+
+	// Both halves keep at least one color.
+	at, seen := 1, b.colors[0].count
+	for at < len(b.colors)-1 && seen < total/2 {
+		seen += b.colors[at].count
+		at++
+	}
+
+	return &colorBox{colors: b.colors[:at]}, &colorBox{colors: b.colors[at:]}
+}
+
+// average returns the average color of the pixels in the box.
+func (b *colorBox) average() color.NRGBA {
+	var sums [3]int
+	total := 0
+	for _, cc := range b.colors {
+		for c := range sums {
+			sums[c] += int(cc.rgb[c]) * cc.count
+		}
+		total += cc.count
+	}
+
+	return color.NRGBA{
+		R: uint8((sums[0] + total/2) / total),
+		G: uint8((sums[1] + total/2) / total),
+		B: uint8((sums[2] + total/2) / total),
+		A: 255,
+	}
+}
+
+// Quantize returns a paletted copy of the image with a palette of at most 256
+// colors chosen from the image by median cut, so images with fewer colors keep
+// them exactly. Pixels that are more than half transparent are made fully
+// transparent, as GIF only supports a single transparent color.
+func Quantize(m image.Image) *image.Paletted {
+	src := imaging.Clone(m)
+
+	counts := make(map[[3]uint8]int)
+	transparent := false
+	for i := 0; i < len(src.Pix); i += 4 {
+		if src.Pix[i+3] < 128 {
+			transparent = true
+			continue
+		}
+
+		counts[[3]uint8{src.Pix[i], src.Pix[i+1], src.Pix[i+2]}]++
+	}
+
+	colors := maxColors
+	if transparent {
+		colors--
+	}
+
+	var p color.Palette
+	if len(counts) > 0 {
+		box := &colorBox{colors: make([]colorCount, 0, len(counts))}
+		for rgb, count := range counts {
+			box.colors = append(box.colors, colorCount{rgb: rgb, count: count})
+		}
+
+		// Repeatedly split the box with the widest span until there are enough
+		// boxes, or none of them can be split.
+		boxes := []*colorBox{box}
+		for len(boxes) < colors {
+			widest, widestSpan := -1, 0
+			for i, b := range boxes {
+				if len(b.colors) < 2 {
+					continue
+				}
+
+				if _, span := b.widest(); span > widestSpan {
+					widest, widestSpan = i, span
+				}
+			}
+
+			if widest == -1 {
+				break
+			}
+
+			a, b := boxes[widest].split()
+			boxes[widest] = a
+			boxes = append(boxes, b)
+		}
+
+		for _, b := range boxes {
+			p = append(p, b.average())
+		}
+	}
+
+	if transparent {
+		p = append(p, color.Transparent)
+	}
+
+	dst := image.NewPaletted(src.Bounds(), p)
+	transparentIndex := uint8(len(p) - 1)
+
+	// Colors are mapped to the nearest color in the palette, which is cached
+	// as the same colors are usually used by many pixels.
+	nearest := make(map[[3]uint8]uint8, len(counts))
+	for i, j := 0, 0; i < len(src.Pix); i, j = i+4, j+1 {
+		if src.Pix[i+3] < 128 {
+			dst.Pix[j] = transparentIndex
+			continue
+		}
+
+		rgb := [3]uint8{src.Pix[i], src.Pix[i+1], src.Pix[i+2]}
+		index, ok := nearest[rgb]
+		if !ok {
+			index = nearestIndex(p, rgb, transparent)
+			nearest[rgb] = index
+		}
+
+		dst.Pix[j] = index
+	}
+
+	return dst
+}
+
+// nearestIndex returns the index of the opaque color in the palette that is
+// closest to the color, where the last color is skipped when it's the
+// transparent color.
+func nearestIndex(p color.Palette, rgb [3]uint8, transparent bool) uint8 {
+	colors := len(p)
+	if transparent {
+		colors--
+	}
+
+	best, bestDistance := 0, -1
+	for i := 0; i < colors; i++ {
+		c := p[i].(color.NRGBA)
+		dr, dg, db := int(c.R)-int(rgb[0]), int(c.G)-int(rgb[1]), int(c.B)-int(rgb[2])
+		if distance := dr*dr + dg*dg + db*db; bestDistance == -1 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	return uint8(best)
+}
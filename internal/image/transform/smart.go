@@ -0,0 +1,201 @@
+package transform
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Crop modes select how the region is chosen when the image is cropped to fit.
+const (
+	// CropModeCenter chooses the region in the center of the image.
+	CropModeCenter = "center"
+
+	// CropModeEntropy chooses the region with the most detail, measured by the
+	// entropy of the luminance.
+	CropModeEntropy = "entropy"
+
+	// CropModeAttention chooses the region that is most likely to draw
+	// attention, measured by the edges, saturation and skin tones.
+	CropModeAttention = "attention"
+)
+
+// analysisSize is the maximum width or height of the image that is analyzed to
+// choose the region, which keeps it fast for large images.
+const analysisSize = 256
+
+// entropyCell is the width and height of the cells that the entropy is measured
+// over.
+const entropyCell = 8
+
+// luminance returns the luminance of the pixel at the offset from 0 to 255.
+func luminance(pix []uint8, i int) float64 {
+	return 0.299*float64(pix[i]) + 0.587*float64(pix[i+1]) + 0.114*float64(pix[i+2])
+}
+
+// entropyScores scores every pixel by the entropy of the luminance of the cell
+// that contains it.
+func entropyScores(m *image.NRGBA) []float64 {
+	size := m.Bounds().Size()
+	scores := make([]float64, size.X*size.Y)
+
+	for cy := 0; cy < size.Y; cy += entropyCell {
+		for cx := 0; cx < size.X; cx += entropyCell {
+			var histogram [16]int
+			var count int
+
+			for y := cy; y < min(cy+entropyCell, size.Y); y++ {
+				for x := cx; x < min(cx+entropyCell, size.X); x++ {
+					histogram[int(luminance(m.Pix, m.PixOffset(x, y)))>>4]++
+					count++
+				}
+			}
+
+			var entropy float64
+			for _, n := range histogram {
+				if n > 0 {
+					p := float64(n) / float64(count)
+					entropy -= p * math.Log2(p)
+				}
+			}
+
+			for y := cy; y < min(cy+entropyCell, size.Y); y++ {
+				for x := cx; x < min(cx+entropyCell, size.X); x++ {
+					scores[y*size.X+x] = entropy
+				}
+			}
+		}
+	}
+
+	return scores
+}
+
+// attentionScores scores every pixel by the strength of the edge at it, its
+// saturation and how close it is to a skin tone.
+func attentionScores(m *image.NRGBA) []float64 {
+	size := m.Bounds().Size()
+	scores := make([]float64, size.X*size.Y)
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			i := m.PixOffset(x, y)
+			l := luminance(m.Pix, i)
+
+			// The edges are found with a Laplacian, repeating the pixels at the
+			// borders of the image.
+			edge := 4*l -
+				luminance(m.Pix, m.PixOffset(x, max(y-1, 0))) -
+				luminance(m.Pix, m.PixOffset(x, min(y+1, size.Y-1))) -
+				luminance(m.Pix, m.PixOffset(max(x-1, 0), y)) -
+				luminance(m.Pix, m.PixOffset(min(x+1, size.X-1), y))
+
+			r, g, b := float64(m.Pix[i])/255, float64(m.Pix[i+1])/255, float64(m.Pix[i+2])/255
+
+			// Saturation is only counted for pixels that are not too dark or
+			// too bright to show it.
+			var saturation float64
+			if high, low := max(r, g, b), min(r, g, b); high > 0 && l > 25 && l < 230 {
+				saturation = (high - low) / high
+			}
+
+			// Skin tones are found by the distance of the normalized color
+			// from a typical skin tone.
+			var skin float64
+			if length := math.Sqrt(r*r + g*g + b*b); length > 0 {
+				dr, dg, db := r/length-0.78, g/length-0.57, b/length-0.44
+				skin = max(0, 1-math.Sqrt(dr*dr+dg*dg+db*db)*4)
+			}
+
+			scores[y*size.X+x] = math.Min(math.Abs(edge)/255, 1) + 0.5*saturation + skin
+		}
+	}
+
+	return scores
+}
+
+// SmartRect returns the region with the width and height within the image
+// that scores the highest with the crop mode. Regions with the same score are
+// chosen by their distance to the center of the image, so images without any
+// detail are cropped to the center.
+func SmartRect(m image.Image, width, height int, mode string) image.Rectangle {
+	bounds := m.Bounds()
+	size := bounds.Size()
+
+	width = max(min(width, size.X), 1)
+	height = max(min(height, size.Y), 1)
+
+	if mode == "" || mode == CropModeCenter || (width == size.X && height == size.Y) {
+		x, y := (size.X-width)/2, (size.Y-height)/2
+		return image.Rect(x, y, x+width, y+height).Add(bounds.Min)
+	}
+
+	// Analyze a smaller copy of the image.
+	scale := math.Min(1, float64(analysisSize)/float64(max(size.X, size.Y)))
+	analyzed := imaging.Resize(m, max(int(math.Round(float64(size.X)*scale)), 1), max(int(math.Round(float64(size.Y)*scale)), 1), imaging.Box)
+	as := analyzed.Bounds().Size()
+
+	var scores []float64
+	if mode == CropModeAttention {
+		scores = attentionScores(analyzed)
+	} else {
+		scores = entropyScores(analyzed)
+	}
+
+	// Build a summed area table so the score of every region can be found in
+	// constant time.
+	sums := make([]float64, (as.X+1)*(as.Y+1))
+	for y := 0; y < as.Y; y++ {
+		for x := 0; x < as.X; x++ {
+			sums[(y+1)*(as.X+1)+x+1] = scores[y*as.X+x] + sums[y*(as.X+1)+x+1] + sums[(y+1)*(as.X+1)+x] - sums[y*(as.X+1)+x]
+		}
+	}
+
+	ww := max(min(int(math.Round(float64(width)*scale)), as.X), 1)
+	wh := max(min(int(math.Round(float64(height)*scale)), as.Y), 1)
+
+	bestX, bestY := 0, 0
+	bestScore, bestDistance := math.Inf(-1), math.Inf(1)
+
+	for y := 0; y <= as.Y-wh; y++ {
+		for x := 0; x <= as.X-ww; x++ {
+			score := sums[(y+wh)*(as.X+1)+x+ww] - sums[y*(as.X+1)+x+ww] - sums[(y+wh)*(as.X+1)+x] + sums[y*(as.X+1)+x]
+
+			dx, dy := float64(2*x+ww-as.X), float64(2*y+wh-as.Y)
+			distance := dx*dx + dy*dy
+
+			// Scores are compared with a tolerance, as the sums accumulate
+			// floating point error.
+			if score > bestScore+1e-6 || (score > bestScore-1e-6 && distance < bestDistance) {
+				bestX, bestY, bestScore, bestDistance = x, y, score, distance
+			}
+		}
+	}
+
+	x := max(min(int(math.Round(float64(bestX)/scale)), size.X-width), 0)
+	y := max(min(int(math.Round(float64(bestY)/scale)), size.Y-height), 0)
+
+	return image.Rect(x, y, x+width, y+height).Add(bounds.Min)
+}
+
+// FillImage resizes the image to cover the width and height, and crops it to
+// them with the region centered on the focal point when it's provided,
+// otherwise it's chosen by the crop mode.
+func FillImage(m image.Image, width, height int, mode string, focus *FocalPoint, filter imaging.ResampleFilter) image.Image {
+	size := fillSize(m.Bounds().Size(), width, height)
+	m = imaging.Resize(m, size.X, size.Y, filter)
+
+	if focus != nil {
+		return imaging.Crop(m, focus.Rect(m.Bounds(), width, height))
+	}
+
+	return imaging.Crop(m, SmartRect(m, width, height, mode))
+}
+
+// fillSize returns the size that the image is resized to so that it covers the
+// width and height while keeping its aspect ratio.
+func fillSize(size image.Point, width, height int) image.Point {
+	scale := math.Max(float64(width)/float64(size.X), float64(height)/float64(size.Y))
+
+	return image.Pt(max(int(math.Round(float64(size.X)*scale)), width), max(int(math.Round(float64(size.Y)*scale)), height))
+}
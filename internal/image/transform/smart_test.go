@@ -0,0 +1,134 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"net/url"
+	"testing"
+)
+
+func TestSmartRect(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  image.Rectangle
+		mode     string
+		centered bool
+	}{
+		{"no subject", image.Rectangle{}, CropModeEntropy, true},
+		{"center", image.Rect(10, 10, 60, 60), CropModeCenter, true},
+		{"entropy left", image.Rect(10, 10, 60, 60), CropModeEntropy, false},
+		{"entropy right", image.Rect(240, 40, 290, 90), CropModeEntropy, false},
+		{"attention left", image.Rect(10, 10, 60, 60), CropModeAttention, false},
+		{"attention right", image.Rect(240, 40, 290, 90), CropModeAttention, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := scene(300, 100, tt.subject)
+
+			rect := SmartRect(m, 100, 100, tt.mode)
+			if tt.centered && rect != image.Rect(100, 0, 200, 100) {
+				t.Errorf("Expected the region to be centered, got %v", rect)
+			}
+
+			if !tt.centered && !tt.subject.In(rect) {
+				t.Errorf("Expected the region to contain the subject %v, got %v", tt.subject, rect)
+			}
+
+			// The same image should always produce the same region.
+			if again := SmartRect(m, 100, 100, tt.mode); again != rect {
+				t.Errorf("Expected the same region %v, got %v", rect, again)
+			}
+		})
+	}
+}
+
+func TestImageSmartCrop(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"smart-crop", "crop=smart&width=60&height=40"},
+		{"smart-crop-attention", "crop=1:1,smart&crop-mode=attention&width=50"},
+		{"fit-crop-entropy", "fit=crop&crop-mode=entropy&width=40&height=40"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			m, err := Image(scene(400, 200, image.Rect(280, 60, 380, 160)), o)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			golden(t, tt.name, m)
+		})
+	}
+}
+
+func TestAnimationSmartCrop(t *testing.T) {
+	// The subject is on the right of the first frame and moves to the left of
+	// the second, where it should be cropped out of the window chosen for the
+	// first frame.
+	p := append(color.Palette{color.NRGBA{R: 120, G: 130, B: 140, A: 255}}, palette.Plan9[:255]...)
+	g := &gif.GIF{Config: image.Config{Width: 400, Height: 200, ColorModel: p}}
+	for _, subject := range []image.Rectangle{image.Rect(280, 60, 380, 160), image.Rect(0, 60, 60, 160)} {
+		frame := image.NewPaletted(image.Rect(0, 0, 400, 200), p)
+		draw.Draw(frame, frame.Bounds(), scene(400, 200, subject), image.Point{}, draw.Src)
+
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"smart crop", "crop=smart&width=60&height=40"},
+		{"fit crop", "fit=crop&crop-mode=entropy&width=40&height=40"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			out, err := Animation(g, o)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if uniform(out.Image[0]) {
+				t.Errorf("Expected the first frame to contain the subject, it did not")
+			}
+
+			if !uniform(out.Image[1]) {
+				t.Errorf("Expected the second frame to be cropped to the window of the first, it was not")
+			}
+		})
+	}
+}
+
+// uniform returns true when every pixel of the frame is the same color.
+func uniform(m *image.Paletted) bool {
+	for _, i := range m.Pix {
+		if m.Palette[i] != m.Palette[m.Pix[0]] {
+			return false
+		}
+	}
+
+	return true
+}
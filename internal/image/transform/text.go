@@ -0,0 +1,227 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// MaxTextLength is the maximum number of characters in the text.
+	MaxTextLength = 1000
+
+	// MaxTextSize is the maximum size of the text in pixels.
+	MaxTextSize = 1000
+
+	// defaultTextSize is the size of the text in pixels when it's not
+	// provided.
+	defaultTextSize = 24
+)
+
+// shadowColor is the color of the shadow drawn behind the text.
+var shadowColor = color.NRGBA{A: 160}
+
+// Text is the text drawn over the image, such as a caption.
+type Text struct {
+	// Value is the text, where newlines start new lines.
+	Value string
+
+	// Size is the size of the text in pixels or as a percentage of the height
+	// of the image.
+	Size Length
+
+	// Color is the color of the text.
+	Color color.Color
+
+	// Font is the name of the font of the text.
+	Font string
+
+	// Align is the anchor that the text is positioned at, which also aligns
+	// the lines with each other.
+	Align string
+
+	// Pad is the space between the text and the edges of the image, in pixels
+	// or as a percentage of the size of the image.
+	Pad Length
+
+	// Width is the width that the lines are wrapped at, in pixels or as a
+	// percentage of the width of the image, where zero wraps them at the
+	// width inside the padding.
+	Width Length
+
+	// Shadow is the size of the shadow drawn behind the text in pixels, which
+	// is zero when it's not drawn.
+	Shadow float64
+}
+
+// parseText parses the text parameters, returning nil when the text is not
+// provided.
+func parseText(p *Parser) *Text {
+	t := &Text{
+		Value: p.Values.Get("txt"),
+		Size:  Length{Value: defaultTextSize},
+		Color: color.Black,
+		Font:  p.Enum("txt-font", FontNames()...),
+		Align: p.Enum("txt-align", overlayPositions[:len(overlayPositions)-1]...),
+	}
+
+	if len([]rune(t.Value)) > MaxTextLength {
+		p.Fail("txt", "must be at most 1000 characters")
+	}
+
+	if size := p.Values.Get("txt-size"); size != "" {
+		var ok bool
+		if t.Size, ok = parseLength(size, true); !ok || (!t.Size.Percent && t.Size.Value > MaxTextSize) {
+			p.Fail("txt-size", "must be an integer between 1 and 1000 or a percentage in the form {n}p")
+		}
+	}
+
+	if c := p.Values.Get("txt-color"); c != "" {
+		if t.Color, _ = ParseColor(c); t.Color == nil {
+			p.Fail("txt-color", "must be a hex color or in the form {r},{g},{b} or {r},{g},{b},{a}")
+		}
+	}
+
+	if pad := p.Values.Get("txt-pad"); pad != "" {
+		var ok bool
+		if t.Pad, ok = parseLength(pad, false); !ok {
+			p.Fail("txt-pad", "must be a non-negative integer or a percentage in the form {n}p")
+		}
+	}
+
+	if width := p.Values.Get("txt-width"); width != "" {
+		var ok bool
+		if t.Width, ok = parseLength(width, true); !ok {
+			p.Fail("txt-width", "must be a positive integer or a percentage in the form {n}p")
+		}
+	}
+
+	t.Shadow, _ = p.Number("txt-shadow", 0, 100)
+
+	if t.Value == "" {
+		return nil
+	}
+
+	if t.Font == "" {
+		t.Font = DefaultFont
+	}
+
+	if t.Align == "" {
+		t.Align = "center"
+	}
+
+	return t
+}
+
+// wrapText splits the text into lines at the newlines, and wraps the lines
+// at the spaces between words so that they are at most the width. Words that
+// are wider than the width are not split.
+func wrapText(face font.Face, text string, width fixed.Int26_6) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			if line == "" {
+				line = word
+			} else if next := line + " " + word; font.MeasureString(face, next) <= width {
+				line = next
+			} else {
+				lines = append(lines, line)
+				line = word
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// TextImage draws the text over the image with its shadow. The text is
+// wrapped at its width and positioned at its anchor inside the padding.
+func TextImage(m image.Image, t *Text) (image.Image, error) {
+	f, err := getFont(t.Font)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get the font")
+	}
+
+	bounds := m.Bounds()
+
+	size := t.Size.Pixels(bounds.Dy())
+	if size < 1 {
+		size = 1
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create the font face")
+	}
+	defer face.Close()
+
+	padX, padY := t.Pad.Pixels(bounds.Dx()), t.Pad.Pixels(bounds.Dy())
+
+	width := bounds.Dx() - 2*padX
+	if t.Width.Value > 0 {
+		width = t.Width.Pixels(bounds.Dx())
+	}
+
+	lines := wrapText(face, t.Value, fixed.I(width))
+
+	// Measure the lines to position them as a block.
+	metrics := face.Metrics()
+	widths := make([]int, len(lines))
+	block := image.Pt(0, metrics.Height.Ceil()*len(lines))
+	for i, line := range lines {
+		widths[i] = font.MeasureString(face, line).Ceil()
+		if widths[i] > block.X {
+			block.X = widths[i]
+		}
+	}
+
+	anchor, ok := anchors[t.Align]
+	if !ok {
+		anchor = anchors["center"]
+	}
+
+	origin := image.Pt(
+		padX+int(math.Round(float64(bounds.Dx()-2*padX-block.X)*anchor[0])),
+		padY+int(math.Round(float64(bounds.Dy()-2*padY-block.Y)*anchor[1])),
+	)
+
+	drawLines := func(dst draw.Image, c color.Color, offset int) {
+		d := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face}
+		for i, line := range lines {
+			x := origin.X + int(math.Round(float64(block.X-widths[i])*anchor[0])) + offset
+			y := origin.Y + metrics.Height.Ceil()*i + metrics.Ascent.Ceil() + offset
+			d.Dot = fixed.P(x, y)
+			d.DrawString(line)
+		}
+	}
+
+	dst := imaging.Clone(m)
+
+	// Draw the shadow onto its own layer so that it can be blurred before
+	// it's composited.
+	if t.Shadow > 0 {
+		layer := image.NewNRGBA(dst.Bounds())
+		drawLines(layer, shadowColor, int(math.Round(t.Shadow/2)))
+
+		dst = imaging.Overlay(dst, imaging.Blur(layer, t.Shadow/2), image.Point{}, 1)
+	}
+
+	drawLines(dst, t.Color, 0)
+
+	return dst, nil
+}
@@ -0,0 +1,117 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestTextImage(t *testing.T) {
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+
+	tests := []struct {
+		name string
+		text Text
+	}{
+		{"center", Text{Value: "Hello", Size: Length{Value: 16}, Color: white, Font: DefaultFont, Align: "center"}},
+		{"wrap", Text{Value: "Hello there world", Size: Length{Value: 25, Percent: true}, Color: white, Font: "bold", Align: "top-left", Pad: Length{Value: 4}}},
+		{"shadow", Text{Value: "ims", Size: Length{Value: 20}, Color: white, Font: "mono", Align: "bottom-right", Pad: Length{Value: 2}, Shadow: 3}},
+	}
+
+	m := scene(64, 48, image.Rect(16, 8, 48, 40))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := TextImage(m, &tt.text)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			golden(t, "text-"+tt.name, out)
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	f, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		t.Fatalf("Failed to parse the font: %v", err)
+	}
+
+	// Every character of the monospaced font at 10px is 6px wide.
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 10, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		t.Fatalf("Failed to create the face: %v", err)
+	}
+	defer face.Close()
+
+	tests := []struct {
+		text     string
+		width    int
+		expected []string
+	}{
+		{"one two three", 1000, []string{"one two three"}},
+		{"one two three", 48, []string{"one two", "three"}},
+		{"one  two\nthree", 1000, []string{"one two", "three"}},
+		{"extraordinary word", 30, []string{"extraordinary", "word"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			lines := wrapText(face, tt.text, fixed.I(tt.width))
+			if strings.Join(lines, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected the lines %q, got %q", tt.expected, lines)
+			}
+		})
+	}
+}
+
+func TestLoadFonts(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"Brand.ttf":  gomono.TTF,
+		"readme.txt": []byte("not a font"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write the font: %v", err)
+		}
+	}
+
+	names, err := LoadFonts(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if strings.Join(names, ",") != "brand" {
+		t.Errorf("Expected the brand font to be loaded, got %v", names)
+	}
+
+	if _, err := getFont("brand"); err != nil {
+		t.Errorf("Expected the brand font to be available, got %v", err)
+	}
+
+	found := false
+	for _, name := range FontNames() {
+		found = found || name == "brand"
+	}
+
+	if !found {
+		t.Errorf("Expected the brand font in the font names, got %v", FontNames())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.otf"), []byte("not a font"), 0644); err != nil {
+		t.Fatalf("Failed to write the font: %v", err)
+	}
+
+	if _, err := LoadFonts(dir); err == nil {
+		t.Errorf("Expected an error for the broken font")
+	}
+}
@@ -1,12 +1,12 @@
 package transform
 
 import (
+	"fmt"
 	"image"
-	"net/url"
-	"strconv"
-	"strings"
+	"math"
 
 	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,10 +27,10 @@ func RotateImage(m image.Image, orient string) image.Image {
 	case "vh":
 		return imaging.FlipH(imaging.FlipV(m))
 
-	// case "1":
-	//  // Parse the EXIF data and perform a rotation automatically.
-	// 	// Pending support from https://github.com/golang/go/issues/4341
-	// 	return m
+	case "1":
+		// The EXIF orientation is applied when the image is decoded, as the
+		// orientation is not available from the decoded image.
+		return m
 
 	case "2":
 		return imaging.FlipH(m)
@@ -55,98 +55,45 @@ func RotateImage(m image.Image, orient string) image.Image {
 
 // CropImage performs cropping operations based on the api described:
 // https://docs.fastly.com/api/imageopto/crop
-func CropImage(m image.Image, crop string) image.Image {
-	// This assumes that the crop string contains the following form:
-	//   {width},{height}
-	// And will anchor it to the center point.
-	if wh := strings.Split(crop, ","); len(wh) == 2 {
-		width, err := strconv.Atoi(wh[0])
-		if err != nil {
-			return m
-		}
-
-		height, err := strconv.Atoi(wh[1])
-		if err != nil {
-			return m
-		}
-
-		return imaging.CropCenter(m, width, height)
-	}
-
-	return m
-}
-
-// =============================================================================
-
-// GetResizeDimension will get the resize dimension.
-func GetResizeDimension(resize string) int {
-	if resize == "" {
-		return 0
-	}
-
-	dimension, err := strconv.Atoi(resize)
-	if err != nil {
-		return 0
-	}
-
-	if dimension > 8192 {
-		return 8192
-	}
-
-	return dimension
-}
-
-// =============================================================================
-
-// GetResampleFilter gets the resample filter to use for resizing.
-func GetResampleFilter(filter string) imaging.ResampleFilter {
-	switch filter {
-	case "lanczos":
-		return imaging.Lanczos
-	case "nearest":
-		return imaging.NearestNeighbor
-	case "linear":
-		return imaging.Linear
-	case "netravali":
-		return imaging.MitchellNetravali
-	case "box":
-		return imaging.Box
-	case "gaussian":
-		return imaging.Gaussian
-	default:
-		return imaging.Lanczos
-	}
+func CropImage(m image.Image, c *Crop, focus *FocalPoint) image.Image {
+	return imaging.Crop(m, cropRect(m, c, focus))
 }
 
-// =============================================================================
-
-// GetFit will return the fit parameter.
-func GetFit(fit string) string {
-	switch fit {
-	case "cover":
-		return "cover"
-	case "bounds":
-		return "bounds"
+// cropRect returns the region of the image to crop to. The region is centered
+// on the focal point when it's not positioned, otherwise it's chosen by the
+// crop mode.
+func cropRect(m image.Image, c *Crop, focus *FocalPoint) image.Rectangle {
+	rect := c.Rect(m.Bounds())
+
+	switch {
+	case c.Positioned:
+		return rect
+	case focus != nil:
+		return focus.Rect(m.Bounds(), rect.Dx(), rect.Dy())
+	case c.Mode != "":
+		return SmartRect(m, rect.Dx(), rect.Dy(), c.Mode)
 	default:
-		return ""
+		return rect
 	}
 }
 
 // =============================================================================
 
-// ResizeImage resizes the image with the given resample filter.
-func ResizeImage(m image.Image, w, h string, originalWidth, originalHeight int, fit string, filter imaging.ResampleFilter) image.Image {
-	width := GetResizeDimension(w)
-	height := GetResizeDimension(h)
+// ResizeImage resizes the image to the width and height of the options with
+// their resample filter, constraining it with their fit when both are provided.
+// The focal point is kept in frame when the image is cropped to fit.
+func ResizeImage(m image.Image, o *Options, focus *FocalPoint) image.Image {
+	width, height := o.Width, o.Height
+	size := m.Bounds().Size()
 
 	// If both width and height are provided, and we have a valid fit mode, then
 	// perform a resize.
 	if width > 0 && height > 0 {
-		switch fit {
+		switch o.Fit {
 		case "bounds":
 			// Calculate the scales relative to the originals.
-			widthScale := float32(width) / float32(originalWidth)
-			heightScale := float32(height) / float32(originalHeight)
+			widthScale := float64(width) / float64(size.X)
+			heightScale := float64(height) / float64(size.Y)
 
 			// Find the smallest scale.
 			scale := widthScale
@@ -154,35 +101,47 @@ func ResizeImage(m image.Image, w, h string, originalWidth, originalHeight int,
 				scale = heightScale
 			}
 
-			// Calculate the resized dimensions.
-			width = int(float32(originalWidth) * scale)
-			height = int(float32(originalHeight) * scale)
+			// Calculate the resized dimensions, rounding them so that the
+			// dimension that was limited is not truncated to one pixel less.
+			width = max(int(math.Round(float64(size.X)*scale)), 1)
+			height = max(int(math.Round(float64(size.Y)*scale)), 1)
 
 			// Resize the original dimensions to that scale.
-			return imaging.Resize(m, width, height, filter)
+			return imaging.Resize(m, width, height, o.Filter)
 		case "cover":
-			return imaging.Resize(m, width, height, filter)
+			// Scale the image to cover the region and crop the center of it,
+			// or around the focal point when it's known.
+			if focus != nil {
+				return FillImage(m, width, height, "", focus, o.Filter)
+			}
+
+			return imaging.Fill(m, width, height, imaging.Center, o.Filter)
+		case "crop":
+			return FillImage(m, width, height, o.CropMode, focus, o.Filter)
+		case "fill":
+			// Stretch the image to the region without keeping its aspect ratio.
+			return imaging.Resize(m, width, height, o.Filter)
 		}
 	}
 
 	// Resize the width if it was provided.
 	if width > 0 {
-		if width > originalWidth {
+		if width > size.X && !o.Upscale {
 			// Don't resize if it's larger than the original!
 			return m
 		}
 
-		return imaging.Resize(m, width, 0, filter)
+		return imaging.Resize(m, width, 0, o.Filter)
 	}
 
 	// Resize the height if provided.
 	if height > 0 {
-		if height > originalHeight {
+		if height > size.Y && !o.Upscale {
 			// Don't resize if it's larger than the original!
 			return m
 		}
 
-		return imaging.Resize(m, 0, height, filter)
+		return imaging.Resize(m, 0, height, o.Filter)
 	}
 
 	return m
@@ -190,10 +149,10 @@ func ResizeImage(m image.Image, w, h string, originalWidth, originalHeight int,
 
 // =============================================================================
 
-// Image transforms the image based on data found in the request. Following the
-// available query params in the root README, this will parse the query params
-// and apply image transformations.
-func Image(m image.Image, v url.Values) (image.Image, error) {
+// Image transforms the image based on the options parsed from the request.
+// Following the available query params in the root README, this will apply the
+// image transformations.
+func Image(m image.Image, o *Options) (image.Image, error) {
 	// Extract the width + height from the image bounds.
 	width := m.Bounds().Max.X
 	height := m.Bounds().Max.Y
@@ -203,37 +162,82 @@ func Image(m image.Image, v url.Values) (image.Image, error) {
 		"height": height,
 	})).Debug("image dimensions")
 
-	// Crop the image if the crop parameter was provided.
-	if crop := v.Get("crop"); crop != "" {
-		// Crop the image.
-		m = CropImage(m, crop)
+	// Crop the image if the crop parameter was provided, keeping the focal
+	// point relative to the cropped image.
+	focus := o.Focus
+	if o.Crop != nil {
+		rect := cropRect(m, o.Crop, focus)
+		if focus != nil {
+			focus = focus.Within(m.Bounds(), rect)
+		}
+
+		m = imaging.Crop(m, rect)
 	}
 
 	// Resize the image if the width or height are provided.
-	w := v.Get("width")
-	h := v.Get("height")
-
-	if w != "" || h != "" {
-		// Get the resize filter to use.
-		filter := GetResampleFilter(v.Get("resize-filter"))
-		fit := GetFit(v.Get("fit"))
-
-		m = ResizeImage(m, w, h, width, height, fit, filter)
+	if o.Width > 0 || o.Height > 0 {
+		m = ResizeImage(m, o, focus)
 	}
 
 	// Reorient the image if the orientation parameter was provided.
-	if orient := v.Get("orient"); orient != "" {
-		// Rotate the image.
-		m = RotateImage(m, orient)
+	if o.Orient != "" {
+		m = RotateImage(m, o.Orient)
 	}
 
+	// Adjust the color and tone of the image.
+	m = AdjustImage(m, &o.Adjustments)
+
+	// Apply the color filters to the image.
+	m = ColorImage(m, &o.Colors)
+
 	// Blur the image if the parameter was provided.
-	if blur := v.Get("blur"); blur != "" {
-		sigma, err := strconv.ParseFloat(blur, 64)
-		if err == nil && sigma > 0 {
-			m = imaging.Blur(m, sigma)
+	if o.Blur > 0 {
+		m = imaging.Blur(m, o.Blur)
+	}
+
+	// Composite the overlay over the image if it was provided.
+	if o.Overlay != nil {
+		m = OverlayImage(m, o.Overlay)
+	}
+
+	// Draw the text over the image if it was provided.
+	if o.Text != nil {
+		tm, err := TextImage(m, o.Text)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not draw the text")
 		}
+
+		m = tm
+	}
+
+	// Pad the image and place it on the canvas if they were provided, as long
+	// as the result is not larger than the largest image that can be resized
+	// to.
+	if o.Pad != nil {
+		if size := o.Pad.Size(m.Bounds().Size()); size.X > MaxDimension || size.Y > MaxDimension {
+			return nil, tooLarge("pad", o.Pad.String())
+		}
+
+		m = PadImage(m, o.Pad, o.Background)
+	}
+
+	if o.Canvas != nil {
+		if size := canvasSize(m.Bounds().Size(), o.Canvas); size.X > MaxDimension || size.Y > MaxDimension {
+			return nil, tooLarge("canvas", o.Canvas.String())
+		}
+
+		m = CanvasImage(m, o.Canvas, o.Background)
 	}
 
 	return m, nil
 }
+
+// tooLarge returns the error for a parameter that would make the image larger
+// than MaxDimension.
+func tooLarge(param, value string) error {
+	return ParamErrors{&ParamError{
+		Param:   param,
+		Value:   value,
+		Message: fmt.Sprintf("can't make the image larger than %dx%d", MaxDimension, MaxDimension),
+	}}
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// banded returns an opaque white image of the size with a red band on the left
+// edge of the width.
+func banded(width, height, band int) *image.NRGBA {
+	m := solid(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < band; x++ {
+			i := m.PixOffset(x, y)
+			m.Pix[i+1], m.Pix[i+2] = 0, 0
+		}
+	}
+
+	return m
+}
+
+func TestResizeImage(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+
+	tests := []struct {
+		name  string
+		query string
+		size  image.Point
+		left  color.NRGBA
+	}{
+		{"width", "width=100", image.Pt(100, 50), red},
+		{"height", "height=25", image.Pt(50, 25), red},
+		{"width without upscale", "width=400", image.Pt(200, 100), red},
+		{"height without upscale", "height=300", image.Pt(200, 100), red},
+		{"width with upscale", "width=400&enable=upscale", image.Pt(400, 200), red},
+		{"height with upscale", "height=300&enable=upscale", image.Pt(600, 300), red},
+		{"bounds", "width=50&height=50&fit=bounds", image.Pt(50, 25), red},
+		{"cover", "width=50&height=50&fit=cover", image.Pt(50, 50), white},
+		{"cover with focal point", "width=50&height=50&fit=cover&fp-x=0", image.Pt(50, 50), red},
+		{"crop", "width=50&height=50&fit=crop", image.Pt(50, 50), white},
+		{"fill", "width=50&height=50&fit=fill", image.Pt(50, 50), red},
+		{"without fit", "width=50&height=50", image.Pt(50, 25), red},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+
+			o, err := ParseOptions(v)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			m := ResizeImage(banded(200, 100, 50), o, o.Focus)
+
+			if size := m.Bounds().Size(); size != tt.size {
+				t.Errorf("Expected the size %v, got %v", tt.size, size)
+			}
+
+			// The band is only cropped off when the image is scaled to cover
+			// the region and cropped in the center.
+			if c := color.NRGBAModel.Convert(m.At(1, m.Bounds().Dy()/2)); c != tt.left {
+				t.Errorf("Expected the left edge to be %v, got %v", tt.left, c)
+			}
+		})
+	}
+}
+
+func TestResizeImageBounds(t *testing.T) {
+	// A scale of 1/2 resizes the height to 166.5, which is rounded.
+	m := ResizeImage(solid(1000, 333), &Options{Width: 500, Height: 500, Fit: "bounds", Filter: imaging.Lanczos}, nil)
+	if size := m.Bounds().Size(); size != image.Pt(500, 167) {
+		t.Errorf("Expected the size 500x167, got %v", size)
+	}
+}
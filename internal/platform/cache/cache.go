@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Entry is a processed image stored in the cache.
+type Entry struct {
+	// Header is the header written with the processed image.
+	Header http.Header
+
+	// Body is the encoded image.
+	Body []byte
+
+	// Expires is when the entry should no longer be served from the cache.
+	Expires time.Time
+
+	// Stored is when the entry was stored in the cache.
+	Stored time.Time
+}
+
+// Size returns the approximate number of bytes used by the entry.
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Body))
+	for key, values := range e.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+
+	return size
+}
+
+// Expired returns true when the entry should no longer be served.
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Cache describes a store for processed images.
+type Cache interface {
+	// Get returns the entry stored with the key if it exists and has not
+	// expired.
+	Get(key string) (*Entry, bool)
+
+	// Set stores the entry with the key.
+	Set(key string, entry *Entry)
+}
+
+// New returns the cache described by the reference, where ":memory:" will
+// create a memory based cache, and any other value will be used as the
+// directory for a file based cache, both limited to maxBytes. An empty
+// reference disables the cache and returns nil.
+func New(reference string, maxBytes int64) (Cache, error) {
+	switch reference {
+	case "":
+		logrus.Debug("result cache disabled")
+
+		return nil, nil
+
+	case ":memory:":
+		logrus.WithField("maxBytes", maxBytes).Debug("memory result cache enabled")
+
+		return NewMemory(maxBytes), nil
+
+	default:
+		c, err := NewDisk(reference, maxBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create the disk cache")
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"directory": reference,
+			"maxBytes":  maxBytes,
+		}).Debug("disk result cache enabled")
+
+		return c, nil
+	}
+}
@@ -0,0 +1,395 @@
+package cache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/platform/cache"
+)
+
+func TestMemory(t *testing.T) {
+	c := cache.NewMemory(100)
+
+	c.Set("a", &cache.Entry{Body: make([]byte, 40)})
+	c.Set("b", &cache.Entry{Body: make([]byte, 40)})
+
+	// Use "a" so that "b" is the least recently used.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("Expected a to be cached, it was not")
+	}
+
+	c.Set("c", &cache.Entry{Body: make([]byte, 40)})
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected b to be evicted, it was not")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s to be cached, it was not", key)
+		}
+	}
+
+	if bytes := c.Bytes(); bytes != 80 {
+		t.Errorf("Expected 80 bytes to be used, got %d", bytes)
+	}
+
+	// Entries larger than the budget are never stored.
+	c.Set("d", &cache.Entry{Body: make([]byte, 101)})
+	if _, ok := c.Get("d"); ok {
+		t.Errorf("Expected d to not be cached, it was")
+	}
+
+	// Expired entries are not returned.
+	c.Set("e", &cache.Entry{Body: make([]byte, 1), Expires: time.Now().Add(-time.Second)})
+	if _, ok := c.Get("e"); ok {
+		t.Errorf("Expected e to be expired, it was not")
+	}
+}
+
+func TestDisk(t *testing.T) {
+	c, err := cache.NewDisk(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	header := http.Header{"Content-Type": []string{"image/png"}}
+	c.Set("a", &cache.Entry{Header: header, Body: []byte("image")})
+	c.Set("b", &cache.Entry{Body: []byte("image"), Expires: time.Now().Add(-time.Second)})
+
+	entry, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Expected a to be cached, it was not")
+	}
+
+	if string(entry.Body) != "image" || entry.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the cached entry to match, got %+v", entry)
+	}
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected b to be expired, it was not")
+	}
+
+	if _, ok := c.Get("c"); ok {
+		t.Errorf("Expected c to not be cached, it was")
+	}
+}
+
+func TestDiskEviction(t *testing.T) {
+	dir := t.TempDir()
+
+	// Each entry is encoded with some overhead, so the budget fits two of them.
+	c, err := cache.NewDisk(dir, 1100)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	c.Set("a", &cache.Entry{Body: make([]byte, 400)})
+	c.Set("b", &cache.Entry{Body: make([]byte, 400)})
+
+	// Use "a" so that "b" is the least recently used.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("Expected a to be cached, it was not")
+	}
+
+	c.Set("c", &cache.Entry{Body: make([]byte, 400)})
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected b to be evicted, it was not")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s to be cached, it was not", key)
+		}
+	}
+
+	if bytes := c.Bytes(); bytes == 0 || bytes > 1100 {
+		t.Errorf("Expected at most 1100 bytes to be used, got %d", bytes)
+	}
+
+	// Entries larger than the budget are never stored.
+	c.Set("d", &cache.Entry{Body: make([]byte, 1101)})
+	if _, ok := c.Get("d"); ok {
+		t.Errorf("Expected d to not be cached, it was")
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Errorf("Expected 2 files in the cache directory, got %d", len(files))
+	}
+
+	// The entries are kept when the cache is created again, and the least
+	// recently used are evicted when they no longer fit within the budget.
+	c, err = cache.NewDisk(dir, 600)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, ok := c.Get("c"); !ok {
+		t.Errorf("Expected c to be cached, it was not")
+	}
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Expected a to be evicted, it was not")
+	}
+}
+
+func TestDiskOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// Files that are not entries are never added to the cache, so they are
+	// never evicted.
+	for _, name := range []string{"precious.jpg", ".tmp-123", strings.Repeat("0", 63) + "g"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 1000), 0o644); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	c, err := cache.NewDisk(dir, 100)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if bytes := c.Bytes(); bytes != 0 {
+		t.Errorf("Expected no bytes to be used, got %d", bytes)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(files) != 3 {
+		t.Errorf("Expected the 3 files to be kept, got %d", len(files))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	calls := 0
+	handler := cache.Middleware(cache.NewMemory(1<<20), time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing.png" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(r.URL.RawQuery))
+	})
+
+	tableData := []struct {
+		Path  string
+		Calls int
+		Code  int
+	}{
+		{Path: "/image.png?width=10&height=20", Calls: 1, Code: http.StatusOK},
+		{Path: "/image.png?height=20&width=10", Calls: 1, Code: http.StatusOK},
+		{Path: "/image.png?height=20&width=10&sig=abc", Calls: 1, Code: http.StatusOK},
+		{Path: "/image.png?width=11", Calls: 2, Code: http.StatusOK},
+		{Path: "/other.png?width=10&height=20", Calls: 3, Code: http.StatusOK},
+		{Path: "/missing.png", Calls: 4, Code: http.StatusNotFound},
+		{Path: "/missing.png", Calls: 5, Code: http.StatusNotFound},
+	}
+
+	for i, tableCase := range tableData {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", tableCase.Path, nil))
+
+		if rr.Code != tableCase.Code {
+			t.Errorf("Expected case %d to have status %d, got %d", i, tableCase.Code, rr.Code)
+		}
+
+		if calls != tableCase.Calls {
+			t.Errorf("Expected case %d to have called the handler %d times, got %d", i, tableCase.Calls, calls)
+		}
+
+		if tableCase.Code == http.StatusOK && rr.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("Expected case %d to have the content type header, it did not", i)
+		}
+	}
+}
+
+func TestCoalesceMiddleware(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	handler := cache.CoalesceMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		if err := r.Context().Err(); err != nil {
+			t.Errorf("Expected the context to not be canceled, got %v", err)
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(r.URL.RawQuery))
+	})
+
+	// The first request is canceled before the response is ready, which should
+	// not affect the other requests.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	paths := []string{
+		"/image.png?width=10&height=20",
+		"/image.png?height=20&width=10",
+		"/image.png?height=20&width=10&sig=abc",
+		"/image.png?width=10&height=20",
+	}
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, len(paths))
+	for i, path := range paths {
+		req := httptest.NewRequest("GET", path, nil)
+		if i == 0 {
+			req = req.WithContext(ctx)
+		}
+
+		recorders[i] = httptest.NewRecorder()
+
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler(rr, req)
+		}(recorders[i])
+	}
+
+	// Give the requests time to join the in-flight request before it completes.
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected the handler to be called once, got %d", calls)
+	}
+
+	body := recorders[0].Body.String()
+	for i, rr := range recorders {
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected case %d to have status %d, got %d", i, http.StatusOK, rr.Code)
+		}
+
+		if rr.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("Expected case %d to have the content type header, it did not", i)
+		}
+
+		if rr.Body.String() != body {
+			t.Errorf("Expected case %d to have the body %q, got %q", i, body, rr.Body.String())
+		}
+	}
+}
+
+func TestMiddlewareNotModified(t *testing.T) {
+	handler := cache.Middleware(cache.NewMemory(1<<20), time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("image"))
+	})
+
+	// Populate the cache.
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/image.png", nil))
+
+	req := httptest.NewRequest("GET", "/image.png", nil)
+	req.Header.Set("If-None-Match", `"abc"`)
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, rr.Code)
+	}
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected no body, got %d bytes", rr.Body.Len())
+	}
+}
+
+func TestMiddlewareCacheControl(t *testing.T) {
+	tableData := []struct {
+		CacheControl string
+		Cached       bool
+		Expires      time.Duration
+	}{
+		{CacheControl: "", Cached: true, Expires: time.Hour},
+		{CacheControl: "public, max-age=60", Cached: true, Expires: time.Minute},
+		{CacheControl: "public, max-age=7200", Cached: true, Expires: time.Hour},
+		{CacheControl: "public, max-age=0", Cached: false},
+		{CacheControl: "private, max-age=60", Cached: false},
+		{CacheControl: "public, no-cache, max-age=60", Cached: false},
+		{CacheControl: "no-store", Cached: false},
+	}
+
+	for i, tableCase := range tableData {
+		c := cache.NewMemory(1 << 20)
+		handler := cache.Middleware(c, time.Hour, func(w http.ResponseWriter, r *http.Request) {
+			if tableCase.CacheControl != "" {
+				w.Header().Set("Cache-Control", tableCase.CacheControl)
+			}
+
+			w.Write([]byte("image"))
+		})
+
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/image.png", nil))
+
+		entry, ok := c.Get(cache.Key(httptest.NewRequest("GET", "/image.png", nil)))
+		if ok != tableCase.Cached {
+			t.Errorf("Expected case %d to be cached %t, got %t", i, tableCase.Cached, ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if remaining := time.Until(entry.Expires); remaining > tableCase.Expires || remaining < tableCase.Expires-time.Minute/2 {
+			t.Errorf("Expected case %d to expire in %s, got %s", i, tableCase.Expires, remaining)
+		}
+	}
+}
+
+func TestMiddlewareAge(t *testing.T) {
+	c := cache.NewMemory(1 << 20)
+	handler := cache.Middleware(c, time.Hour, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("image"))
+	})
+
+	// The response from the handler has no age.
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/image.png", nil))
+
+	if age := rr.Header().Get("Age"); age != "" {
+		t.Errorf("Expected no Age header, got %q", age)
+	}
+
+	// Responses from the cache have the age of the entry.
+	key := cache.Key(httptest.NewRequest("GET", "/image.png", nil))
+	entry, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("Expected the response to be cached, it was not")
+	}
+
+	entry.Stored = entry.Stored.Add(-30 * time.Second)
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/image.png", nil))
+
+	if age := rr.Header().Get("Age"); age != "30" {
+		t.Errorf("Expected the Age header to be 30, got %q", age)
+	}
+
+	if entry.Header.Get("Age") != "" {
+		t.Errorf("Expected the cached header to be unchanged, it was not")
+	}
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesced counts the requests that were served by sharing the response of
+// an identical request.
+var coalesced = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "ims",
+	Name:      "coalesced_requests_total",
+	Help:      "The number of image requests that were served by sharing the response of an identical in-flight request.",
+})
+
+// response is the captured response shared between coalesced requests.
+type response struct {
+	header http.Header
+	code   int
+	body   []byte
+}
+
+// CoalesceMiddleware ensures that only one of the identical requests that are
+// in-flight at the same time are processed by the next handler, and shares
+// the response with the others.
+func CoalesceMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	var group singleflight.Group
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		executed := false
+		// Conditional requests may not get the processed image, so they are only
+		// coalesced with requests that have the same conditions.
+		key := Key(r) + "\n" + r.Header.Get("If-None-Match") + "\n" + r.Header.Get("If-Modified-Since")
+
+		v, _, _ := group.Do(key, func() (interface{}, error) {
+			executed = true
+
+			// The response is shared with the other requests, so it should not
+			// be canceled if this client goes away.
+			rec := &recorder{header: make(http.Header)}
+			next(rec, r.WithContext(context.WithoutCancel(r.Context())))
+
+			if rec.code == 0 {
+				rec.code = http.StatusOK
+			}
+
+			return &response{header: rec.header, code: rec.code, body: rec.body.Bytes()}, nil
+		})
+
+		if !executed {
+			coalesced.Inc()
+		}
+
+		res := v.(*response)
+		writeResponse(w, res.header, res.code, res.body)
+	}
+}
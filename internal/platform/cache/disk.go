@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// tempPrefix is the prefix of the temporary files that entries are written to
+// before they are renamed into place.
+const tempPrefix = ".tmp-"
+
+// diskItem is the element stored in the recency list.
+type diskItem struct {
+	filename string
+	size     int64
+}
+
+// Disk is a least recently used cache that stores each entry as a file in a
+// directory until the configured byte budget is exceeded. Expired entries are
+// removed when they are next requested.
+type Disk struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	bytes int64
+	items map[string]*list.Element
+	order *list.List
+}
+
+// NewDisk creates a new Disk cache in the directory that will hold at most
+// maxBytes, creating the directory if it does not exist. Entries left in the
+// directory by a previous run are kept, ordered by when they were last used.
+func NewDisk(dir string, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "cannot create the cache directory")
+	}
+
+	d := &Disk{
+		dir:      dir,
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+
+	if err := d.load(); err != nil {
+		return nil, errors.Wrap(err, "cannot read the cache directory")
+	}
+
+	return d, nil
+}
+
+// isEntryName returns true when the name is the name of an entry, which is the
+// hex encoded sha256 of its key.
+func isEntryName(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+
+	for _, r := range name {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// load adds the entries already in the directory to the cache, evicting the
+// least recently used until the cache fits within its byte budget. Only the
+// files named like entries are added, so that other files in the directory are
+// never evicted.
+func (d *Disk) load() error {
+	dirEntries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	files := make([]os.FileInfo, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.Type().IsRegular() || !isEntryName(dirEntry.Name()) {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, info := range files {
+		d.add(filepath.Join(d.dir, info.Name()), info.Size())
+	}
+
+	return nil
+}
+
+// filename returns the path of the file used to store the key.
+func (d *Disk) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get reads the entry for the key from the disk and marks it as recently used.
+func (d *Disk) Get(key string) (*Entry, bool) {
+	filename := d.filename(key)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var entry Entry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		logrus.WithError(err).WithField("filename", filename).Warn("could not decode the cached entry")
+		return nil, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	el, ok := d.items[filename]
+	if !ok {
+		// The entry was evicted while it was being read.
+		return nil, false
+	}
+
+	if entry.Expired(time.Now()) {
+		d.remove(el)
+		return nil, false
+	}
+
+	d.order.MoveToFront(el)
+
+	// Update the modification time so the order survives a restart.
+	now := time.Now()
+	os.Chtimes(filename, now, now)
+
+	return &entry, true
+}
+
+// Set writes the entry for the key to the disk, evicting the least recently
+// used entries until the cache fits within its byte budget. The entry is
+// written to a temporary file first so concurrent readers never see a partial
+// entry. Entries larger than the budget are not stored.
+func (d *Disk) Set(key string, entry *Entry) {
+	if entry.Size() > d.maxBytes {
+		return
+	}
+
+	if err := d.write(d.filename(key), entry); err != nil {
+		logrus.WithError(err).Warn("could not write the cached entry")
+	}
+}
+
+// Bytes returns the number of bytes currently stored.
+func (d *Disk) Bytes() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.bytes
+}
+
+func (d *Disk) write(filename string, entry *Entry) error {
+	f, err := os.CreateTemp(d.dir, tempPrefix+"*")
+	if err != nil {
+		return errors.Wrap(err, "cannot create the temporary file")
+	}
+	defer os.Remove(f.Name())
+
+	if err := gob.NewEncoder(f).Encode(entry); err != nil {
+		f.Close()
+		return errors.Wrap(err, "cannot encode the entry")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "cannot stat the temporary file")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "cannot close the temporary file")
+	}
+
+	// The encoded entry is slightly larger than the entry itself.
+	if info.Size() > d.maxBytes {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return errors.Wrap(err, "cannot rename the temporary file")
+	}
+
+	if el, ok := d.items[filename]; ok {
+		d.order.Remove(el)
+		delete(d.items, filename)
+		d.bytes -= el.Value.(*diskItem).size
+	}
+
+	d.add(filename, info.Size())
+
+	return nil
+}
+
+// add adds the file to the cache as the most recently used, evicting the least
+// recently used files until the cache fits within its byte budget, the lock
+// must be held.
+func (d *Disk) add(filename string, size int64) {
+	d.items[filename] = d.order.PushFront(&diskItem{filename: filename, size: size})
+	d.bytes += size
+
+	for d.bytes > d.maxBytes {
+		d.remove(d.order.Back())
+	}
+}
+
+// remove removes the element from the cache and its file from the disk, the
+// lock must be held.
+func (d *Disk) remove(el *list.Element) {
+	item := d.order.Remove(el).(*diskItem)
+	delete(d.items, item.filename)
+	d.bytes -= item.size
+
+	if err := os.Remove(item.filename); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).WithField("filename", item.filename).Warn("could not remove the cached entry")
+	}
+}
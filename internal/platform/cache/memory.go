@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// memoryItem is the element stored in the recency list.
+type memoryItem struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+// Memory is a least recently used cache that stores entries in memory until
+// the configured byte budget is exceeded.
+type Memory struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	bytes int64
+	items map[string]*list.Element
+	order *list.List
+}
+
+// NewMemory creates a new Memory cache that will hold at most maxBytes.
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the entry stored with the key and marks it as recently used.
+func (m *Memory) Get(key string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := el.Value.(*memoryItem)
+	if item.entry.Expired(time.Now()) {
+		m.remove(el)
+		return nil, false
+	}
+
+	m.order.MoveToFront(el)
+
+	return item.entry, true
+}
+
+// Set stores the entry, evicting the least recently used entries until the
+// cache fits within its byte budget. Entries larger than the budget are not
+// stored.
+func (m *Memory) Set(key string, entry *Entry) {
+	size := entry.Size()
+	if size > m.maxBytes {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, entry: entry, size: size})
+	m.bytes += size
+
+	for m.bytes > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+}
+
+// Bytes returns the number of bytes currently stored.
+func (m *Memory) Bytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.bytes
+}
+
+// remove removes the element from the cache, the lock must be held.
+func (m *Memory) remove(el *list.Element) {
+	item := m.order.Remove(el).(*memoryItem)
+	delete(m.items, item.key)
+	m.bytes -= item.size
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wyattjoh/ims/internal/image"
+)
+
+// requests counts the requests served by the result cache by their result.
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ims",
+	Subsystem: "result_cache",
+	Name:      "requests_total",
+	Help:      "The number of image requests that were a hit or a miss in the result cache.",
+}, []string{"result"})
+
+// Key returns the key used to cache the processed image for the request based
+// on the host, the path and the canonical transformation parameters.
+func Key(r *http.Request) string {
+	return r.Host + r.URL.Path + "?" + image.CanonicalQuery(r)
+}
+
+// recorder captures the response from the next handler.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+}
+
+// writeResponse writes the header and the body to the response writer.
+func writeResponse(w http.ResponseWriter, header http.Header, code int, body []byte) {
+	// The header is copied as the values may be shared with other responses.
+	for key, values := range header.Clone() {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// Middleware serves processed images from the cache when they are available,
+// otherwise it stores the successful responses from the next handler in the
+// cache for the ttl, where a ttl of zero will never expire entries. Responses
+// that a shared cache must not store are skipped, and entries never outlive the
+// max age of their response.
+func Middleware(c Cache, ttl time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		key := Key(r)
+
+		if entry, ok := c.Get(key); ok {
+			requests.WithLabelValues("hit").Inc()
+
+			// The age of the entry is sent so that downstream caches count
+			// the time it was stored here against its max age.
+			header := entry.Header
+			if !entry.Stored.IsZero() {
+				header = header.Clone()
+				header.Set("Age", strconv.FormatInt(int64(time.Since(entry.Stored).Seconds()), 10))
+			}
+
+			if image.NotModified(r, header) {
+				writeResponse(w, header, http.StatusNotModified, nil)
+				return
+			}
+
+			writeResponse(w, header, http.StatusOK, entry.Body)
+
+			return
+		}
+
+		requests.WithLabelValues("miss").Inc()
+
+		rec := &recorder{header: make(http.Header)}
+		next(rec, r)
+
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+
+		if maxAge, ok := image.SharedMaxAge(rec.header); ok && rec.code == http.StatusOK {
+			entry := &Entry{
+				Header: rec.header.Clone(),
+				Body:   rec.body.Bytes(),
+				Stored: time.Now(),
+			}
+
+			// A ttl of zero will keep the entry until it's evicted, unless the
+			// response has a max age.
+			expires := ttl
+			if expires == 0 || (maxAge != 0 && maxAge < expires) {
+				expires = maxAge
+			}
+
+			if expires != 0 {
+				entry.Expires = time.Now().Add(expires)
+			}
+
+			c.Set(key, entry)
+		}
+
+		writeResponse(w, rec.header, rec.code, rec.body.Bytes())
+	}
+}
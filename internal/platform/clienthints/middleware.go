@@ -0,0 +1,18 @@
+// Package clienthints provides the middleware that uses the client hints of
+// the request as the image parameters.
+package clienthints
+
+import (
+	"net/http"
+
+	"github.com/wyattjoh/ims/internal/image"
+)
+
+// Middleware adds the client hints of the request to the query parameters that
+// are not provided before passing it to the next handler. It must wrap the
+// cache middlewares so that the hints are part of their keys.
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, image.WithClientHints(r))
+	}
+}
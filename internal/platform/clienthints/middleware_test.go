@@ -0,0 +1,23 @@
+package clienthints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var query string
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	})
+
+	r := httptest.NewRequest("GET", "/image.jpg?width=100", nil)
+	r.Header.Set("Sec-CH-DPR", "2")
+
+	handler(httptest.NewRecorder(), r)
+
+	if query != "dpr=2&width=100" {
+		t.Errorf("Expected the hints to be added to the query, got %q", query)
+	}
+}
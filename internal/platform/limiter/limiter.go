@@ -0,0 +1,105 @@
+// Package limiter provides a way to limit the number of images that are
+// processed concurrently.
+package limiter
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrQueueFull is returned when the limiter is at capacity and the queue of
+// waiting work is full.
+var ErrQueueFull = errors.New("too many images being processed")
+
+var (
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ims",
+		Subsystem: "transforms",
+		Name:      "in_flight",
+		Help:      "The number of images being processed.",
+	})
+
+	queued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ims",
+		Subsystem: "transforms",
+		Name:      "queued",
+		Help:      "The number of images waiting to be processed.",
+	})
+
+	rejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ims",
+		Subsystem: "transforms",
+		Name:      "rejected_total",
+		Help:      "The number of images that were rejected because the queue was full.",
+	})
+)
+
+// Limiter limits the number of images that are processed concurrently, while
+// allowing a bounded number of them to wait for their turn.
+type Limiter struct {
+	sem      *semaphore.Weighted
+	maxQueue int64
+	queued   atomic.Int64
+}
+
+// New creates a new Limiter that allows concurrency images to be processed at
+// once with up to maxQueue more waiting. When concurrency is zero, nil is
+// returned, which does not limit anything.
+func New(concurrency, maxQueue int) *Limiter {
+	if concurrency <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		sem:      semaphore.NewWeighted(int64(concurrency)),
+		maxQueue: int64(maxQueue),
+	}
+}
+
+// Queued returns the number of callers waiting for their turn.
+func (l *Limiter) Queued() int64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.queued.Load()
+}
+
+// Acquire waits for a turn to process an image, returning ErrQueueFull if the
+// queue is full. The returned function must be called when the image has been
+// processed.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if !l.sem.TryAcquire(1) {
+		if l.queued.Add(1) > l.maxQueue {
+			l.queued.Add(-1)
+			rejected.Inc()
+
+			return nil, ErrQueueFull
+		}
+
+		queued.Inc()
+		err := l.sem.Acquire(ctx, 1)
+		queued.Dec()
+		l.queued.Add(-1)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot wait for the queue")
+		}
+	}
+
+	inFlight.Inc()
+
+	return func() {
+		inFlight.Dec()
+		l.sem.Release(1)
+	}, nil
+}
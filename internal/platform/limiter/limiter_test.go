@@ -0,0 +1,75 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wyattjoh/ims/internal/platform/limiter"
+)
+
+func TestLimiter(t *testing.T) {
+	l := limiter.New(1, 1)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The second caller waits in the queue until the first is released.
+	acquired := make(chan error)
+	go func() {
+		release, err := l.Acquire(ctx)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	// Wait for the second caller to join the queue, after which the third
+	// caller is rejected as the queue is full.
+	deadline := time.Now().Add(time.Second)
+	for l.Queued() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the second caller to be queued, it was not")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := l.Acquire(ctx); !errors.Is(err, limiter.ErrQueueFull) {
+		t.Errorf("Expected error %v, got %v", limiter.ErrQueueFull, err)
+	}
+
+	release()
+
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected the queued caller to acquire, got %v", err)
+	}
+
+	// A canceled caller stops waiting.
+	release, _ = l.Acquire(ctx)
+	defer release()
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := l.Acquire(canceled); err == nil {
+		t.Errorf("Expected the canceled caller to error, it did not")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := limiter.New(0, 0)
+	if l != nil {
+		t.Fatalf("Expected the limiter to be nil, got %v", l)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+}
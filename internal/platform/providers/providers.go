@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/gregjones/httpcache"
@@ -24,6 +25,18 @@ func (p *Providers) Get(host string) provider.Provider {
 	return provider
 }
 
+// Hosts returns the sorted hosts that have a provider attached to them.
+func (p *Providers) Hosts() []string {
+	hosts := make([]string, 0, len(p.providers))
+	for host := range p.providers {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	return hosts
+}
+
 // NewProviders will return the Providers wrapped.
 func NewProviders(providers map[string]provider.Provider) *Providers {
 	return &Providers{
@@ -127,6 +140,17 @@ func GetRemoteBackendProvider(ctx context.Context, origin, originCache string) (
 	return GetRemoteProviderClient(ctx, originURL, transport)
 }
 
+// GetOriginProvider will get the provider for the origin, which is a remote
+// origin when it contains a scheme, and a directory on the filesystem
+// otherwise.
+func GetOriginProvider(ctx context.Context, origin, originCache string) (provider.Provider, error) {
+	if strings.Contains(origin, "://") {
+		return GetRemoteBackendProvider(ctx, origin, originCache)
+	}
+
+	return &provider.Filesystem{Dir: http.Dir(origin)}, nil
+}
+
 // GetProxyBackendProvider will create a new proxy provider.
 func GetProxyBackendProvider(ctx context.Context, originCache string) (provider.Provider, error) {
 	transport, err := WrapCacheRoundTripper(ctx, http.DefaultTransport, originCache)